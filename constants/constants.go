@@ -1,4 +1,23 @@
 package constants
 
-const DEFAULT_USER_ID = 1002
-const DEFAULT_GROUP_ID = 1000
+const DEFAULT_RUN_IMAGE_SOURCE = "registry"
+const DEFAULT_RUN_IMAGE_PUBLIC_KEY_PATH = "/etc/buildpacks/run-image-cosign.pub"
+const DEFAULT_RUN_IMAGE_NODE_VERSION_LABEL = "io.paketo.ubi-nodejs.node.version"
+const DEFAULT_RUN_IMAGE_NODE_PACKAGE_LABEL = "io.paketo.ubi-nodejs.node.package"
+
+const LABEL_NAMESPACE = "io.paketo.ubi-nodejs"
+
+// SBOM_PATH is where the generated Dockerfiles write the bom.cdx.json and
+// bom.spdx.json documents of the packages installed into an image.
+const SBOM_PATH = "/usr/share/sbom/ubi-nodejs-extension"
+
+// NODE_PACKAGE_PATH is where the generated Dockerfiles record the
+// name-epoch:version-release.arch of the RPM that provides the installed
+// node, which is only known once the packages are installed.
+const NODE_PACKAGE_PATH = "/usr/share/ubi-nodejs-extension/node.package"
+
+// PACKAGE_CACHE_DIR is where the package manager keeps the repository
+// metadata and the downloaded packages when the package cache is enabled.
+// It is in the kaniko dir of the lifecycle extender, which the lifecycle
+// keeps between builds and which is never part of the extended image.
+const PACKAGE_CACHE_DIR = "/kaniko/ubi-nodejs-extension/packages"
@@ -1,9 +1,15 @@
 package ubinodejsextension
 
 import (
+	"encoding/base64"
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 
@@ -24,7 +30,11 @@ type DependencyManager interface {
 	GenerateBillOfMaterials(dependencies ...postal.Dependency) []packit.BOMEntry
 }
 
-func Generate(dependencyManager DependencyManager, logger scribe.Emitter, duringBuildPermissions structs.DuringBuildPermissions, imagesJsonPath string) packit.GenerateFunc {
+// DuringBuildPermissionsResolver returns the user and group the images are
+// built with, and where they were taken from.
+type DuringBuildPermissionsResolver func() (structs.DuringBuildPermissions, string, error)
+
+func Generate(dependencyManager DependencyManager, logger scribe.Emitter, resolveDuringBuildPermissions DuringBuildPermissionsResolver, imagesJsonPath string) packit.GenerateFunc {
 	return func(context packit.GenerateContext) (packit.GenerateResult, error) {
 
 		logger.Title("%s %s", context.Info.Name, context.Info.Version)
@@ -39,7 +49,22 @@ func Generate(dependencyManager DependencyManager, logger scribe.Emitter, during
 
 		logger.Candidates(allNodeVersionsInPriorityOrder)
 
-		configTomlFileContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, context.Stack)
+		// Newer platforms only provide the target distro instead of a stack ID
+		stackId := context.Stack
+		if stackId == "" && context.TargetDistro.Name != "" {
+			var err error
+			stackId, err = utils.GetStackIdFromTargetDistro(context.TargetDistro.Name, context.TargetDistro.Version)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+		}
+
+		targetArch := context.TargetInfo.Arch
+		if targetArch == "" {
+			targetArch = runtime.GOARCH
+		}
+
+		configTomlFileContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, stackId, targetArch)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
@@ -51,7 +76,7 @@ func Generate(dependencyManager DependencyManager, logger scribe.Emitter, during
 		}
 
 		nodeVersion, _ := highestPriorityNodeVersion.Metadata["version"].(string)
-		dependency, err := dependencyManager.Resolve(CONFIG_TOML_PATH, highestPriorityNodeVersion.Name, nodeVersion, context.Stack)
+		dependency, err := dependencyManager.Resolve(CONFIG_TOML_PATH, highestPriorityNodeVersion.Name, nodeVersion, stackId)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
@@ -72,43 +97,505 @@ func Generate(dependencyManager DependencyManager, logger scribe.Emitter, during
 			selectedNodeRunImage = bpNodeRunExtension
 		}
 
+		runMode := getEnvOrDefault("BP_UBI_RUN_MODE", "switch")
+		if runMode == "micro" {
+			// The extender only applies single-stage run.Dockerfiles, so Node.js
+			// can not be installed in another stage and copied over.
+			return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_RUN_MODE=micro is not supported: the lifecycle can only extend the run image with a single-stage run.Dockerfile, use BP_UBI_RUN_MODE=switch or extend")
+		}
+		if runMode != "switch" && runMode != "extend" {
+			return packit.GenerateResult{}, fmt.Errorf("unsupported BP_UBI_RUN_MODE value '%s', expected 'switch' or 'extend'", runMode)
+		}
+		if selectedNodeRunImage == "" && runMode == "switch" {
+			if os.Getenv("BP_UBI_RUN_MODE") != "" {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("no Node.js %d run image is published for %s to switch to, set BP_UBI_RUN_IMAGE_OVERRIDE or use BP_UBI_RUN_MODE=extend", selectedNodeMajorVersion, stackId)
+			}
+			logger.Process("No Node.js %d run image is published for %s, extending the run image of the builder", selectedNodeMajorVersion, stackId)
+			runMode = "extend"
+		}
+		extendRunImage := runMode == "extend"
+		if extendRunImage && bpNodeRunExtension != "" {
+			return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_RUN_IMAGE_OVERRIDE can not be used together with BP_UBI_RUN_MODE=%s", runMode)
+		}
+
+		verifyRunImage := os.Getenv("BP_UBI_RUN_IMAGE_VERIFY") == "true"
+		runImageCheck := os.Getenv("BP_UBI_RUN_IMAGE_CHECK")
+		if runImageCheck != "" && runImageCheck != "warn" && runImageCheck != "fail" {
+			return packit.GenerateResult{}, fmt.Errorf("unsupported BP_UBI_RUN_IMAGE_CHECK value '%s', expected 'warn' or 'fail'", runImageCheck)
+		}
+
+		versionSource, _ := highestPriorityNodeVersion.Metadata["version-source"].(string)
+		if versionSource == "" {
+			versionSource = "default"
+		}
+
+		targetOS := context.TargetInfo.OS
+		if targetOS == "" {
+			targetOS = "linux"
+		}
+		target := fmt.Sprintf("%s/%s", targetOS, targetArch)
+		if context.TargetInfo.Variant != "" {
+			target = fmt.Sprintf("%s/%s", target, context.TargetInfo.Variant)
+		}
+
+		provenance := utils.Provenance{
+			ExtensionID:      context.Info.ID,
+			ExtensionVersion: context.Info.Version,
+			NodeMajorVersion: selectedNodeMajorVersion,
+			VersionSource:    versionSource,
+			StackId:          stackId,
+			Target:           target,
+			TargetDistro:     strings.TrimSpace(fmt.Sprintf("%s %s", context.TargetDistro.Name, context.TargetDistro.Version)),
+		}
+
+		if extendRunImage && (verifyRunImage || runImageCheck != "") {
+			logger.Process("Skipping run image verification and checks, the run image of the builder is extended")
+		} else if verifyRunImage || runImageCheck != "" {
+			runImageReference, err := utils.ParseImageReference(selectedNodeRunImage)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+
+			runImageSource, err := utils.NewRunImageSource(getEnvOrDefault("BP_UBI_RUN_IMAGE_SOURCE", constants.DEFAULT_RUN_IMAGE_SOURCE))
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+
+			if verifyRunImage {
+				logger.Process("Verifying signature of run image %s", selectedNodeRunImage)
+
+				runImageDigest, err := utils.VerifyRunImageSignature(runImageSource, runImageReference, utils.SignatureVerificationConfig{
+					PublicKeyPath:         getEnvOrDefault("BP_UBI_RUN_IMAGE_PUBLIC_KEY", constants.DEFAULT_RUN_IMAGE_PUBLIC_KEY_PATH),
+					TrustRootPath:         os.Getenv("BP_UBI_RUN_IMAGE_TRUST_ROOT"),
+					CertificateIdentity:   os.Getenv("BP_UBI_RUN_IMAGE_CERTIFICATE_IDENTITY"),
+					CertificateOIDCIssuer: os.Getenv("BP_UBI_RUN_IMAGE_CERTIFICATE_OIDC_ISSUER"),
+					RekorPublicKeyPath:    os.Getenv("BP_UBI_RUN_IMAGE_REKOR_PUBLIC_KEY"),
+				})
+				if err != nil {
+					return packit.GenerateResult{}, err
+				}
+
+				runImageReference.Digest = runImageDigest
+				provenance.RunImageDigest = runImageDigest
+				selectedNodeRunImage = fmt.Sprintf("%s@%s", runImageReference, runImageDigest)
+				logger.Subprocess("Verified run image %s", selectedNodeRunImage)
+			}
+
+			if runImageCheck != "" {
+				logger.Process("Checking Node.js version of run image %s", selectedNodeRunImage)
+
+				runImageNode, err := utils.CheckRunImageNodeVersion(
+					runImageSource,
+					runImageReference,
+					targetArch,
+					getEnvOrDefault("BP_UBI_RUN_IMAGE_NODE_VERSION_LABEL", constants.DEFAULT_RUN_IMAGE_NODE_VERSION_LABEL),
+					getEnvOrDefault("BP_UBI_RUN_IMAGE_NODE_PACKAGE_LABEL", constants.DEFAULT_RUN_IMAGE_NODE_PACKAGE_LABEL),
+					selectedNodeMajorVersion,
+				)
+				if err != nil {
+					if runImageCheck == "fail" {
+						return packit.GenerateResult{}, err
+					}
+					logger.Subprocess("Warning: %s", err)
+				} else {
+					logger.Subprocess("Run image provides Node.js %s", runImageNode.Version)
+					if runImageNode.Package != "" {
+						logger.Subprocess("Run image provides package %s", runImageNode.Package)
+					}
+					provenance.NodeVersion = runImageNode.Version
+					provenance.NodePackage = runImageNode.Package
+				}
+			}
+		}
+
 		logger.Process("Selected Node Engine Major version %d", selectedNodeMajorVersion)
 
-		requiredPackagesForBuild, err := utils.GetBuildPackages(context.Stack, int(selectedNodeMajorVersion))
+		if !extendRunImage {
+			provenance.RunImage = selectedNodeRunImage
+		}
+		labels := utils.GetProvenanceLabels(provenance)
+
+		vulnerabilityFeeds, err := utils.GetVulnerabilityFeeds(os.Getenv("BP_UBI_VULNERABILITY_FEED"), context.Platform.Path)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		if len(vulnerabilityFeeds) > 0 {
+			threshold := getEnvOrDefault("BP_UBI_VULNERABILITY_THRESHOLD", "critical")
+			thresholdRank, err := utils.GetSeverityRank(threshold)
+			if err != nil {
+				return packit.GenerateResult{}, fmt.Errorf("unsupported BP_UBI_VULNERABILITY_THRESHOLD value '%s', expected 'low', 'medium', 'high' or 'critical'", threshold)
+			}
+
+			// Vulnerabilities without a severity may be anything up to critical
+			allowUnknownSeverity := os.Getenv("BP_UBI_VULNERABILITY_ALLOW_UNKNOWN_SEVERITY") == "true"
+
+			logger.Process("Checking Node.js %d against %d vulnerability feeds", selectedNodeMajorVersion, len(vulnerabilityFeeds))
+
+			nodePackage := provenance.NodePackage
+			if nodePackage == "" {
+				nodePackage = provenance.NodeVersion
+			}
+
+			vulnerabilities, err := utils.FindVulnerabilities(vulnerabilityFeeds, selectedNodeMajorVersion, nodePackage, provenance.RunImage)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+
+			var blocking []string
+			for _, vulnerability := range vulnerabilities {
+				logger.Subprocess("%s", vulnerability)
+				if vulnerability.Rank() >= thresholdRank || (vulnerability.Severity == "unknown" && !allowUnknownSeverity) {
+					blocking = append(blocking, vulnerability.ID)
+				}
+			}
+			if len(vulnerabilities) == 0 {
+				logger.Subprocess("No known vulnerabilities found")
+			}
+
+			if len(blocking) > 0 {
+				if allowUnknownSeverity {
+					return packit.GenerateResult{}, packit.Fail.WithMessage("found %d vulnerabilities with a severity of %s or higher: %s", len(blocking), threshold, strings.Join(blocking, ", "))
+				}
+				return packit.GenerateResult{}, packit.Fail.WithMessage("found %d vulnerabilities with a severity of %s or higher, or an unknown one: %s", len(blocking), threshold, strings.Join(blocking, ", "))
+			}
+			if len(vulnerabilities) > 0 {
+				logger.Subprocess("Warning: found %d vulnerabilities below the %s severity", len(vulnerabilities), threshold)
+			}
+		}
+
+		nodeProfile, err := utils.GetNodeProfile(stackId, targetArch, int(selectedNodeMajorVersion))
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		distroProfile, err := utils.GetDistroProfile(stackId)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		fips := os.Getenv("BP_UBI_FIPS") == "true"
+		if fips {
+			if !nodeProfile.Fips {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("FIPS mode is not supported for Node.js %d on %s", selectedNodeMajorVersion, stackId)
+			}
+			logger.Process("Enabling FIPS mode for Node.js %d", selectedNodeMajorVersion)
+		}
+
+		openShiftCompat := os.Getenv("BP_UBI_OPENSHIFT_COMPAT") == "true"
+		openShiftNssWrapperPackage := ""
+		if openShiftCompat {
+			openShiftNssWrapperPackage = nodeProfile.GetNssWrapperPackage()
+			if openShiftNssWrapperPackage == "" {
+				return packit.GenerateResult{}, fmt.Errorf("no nss_wrapper package found for Node.js version %d and image %s", selectedNodeMajorVersion, stackId)
+			}
+			logger.Process("Preparing the run image for arbitrary user IDs in group 0")
+		}
+
+		localePackages, localeEnv, err := utils.GetLocalePackages(os.Getenv("BP_UBI_LOCALES"), os.Getenv("BP_UBI_TIMEZONE_DATA"))
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		if len(localePackages) > 0 {
+			logger.Process("Installing the locale and time zone data %s", strings.Join(localePackages, " "))
+		}
+		timezoneData := slices.Contains(localePackages, "tzdata")
+
+		var fullICUPackages []string
+		if os.Getenv("BP_NODE_FULL_ICU") == "true" {
+			fullICUPackages = nodeProfile.GetFullICUPackages()
+			if len(fullICUPackages) == 0 {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("full ICU data is not available for Node.js %d on %s", selectedNodeMajorVersion, stackId)
+			}
+			logger.Process("Installing the full ICU data of Node.js %d", selectedNodeMajorVersion)
+		}
+
+		packageManager, err := utils.GetPackageManager(getEnvOrDefault("BP_UBI_PACKAGE_MANAGER", distroProfile.PackageManager))
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		if packageManager.Name != "microdnf" {
+			logger.Process("Using package manager %s", packageManager.Name)
+		}
+
+		packageCache := os.Getenv("BP_UBI_PACKAGE_CACHE") == "true"
+		if packageCache {
+			logger.Process("Keeping the downloaded packages in %s for the next build", constants.PACKAGE_CACHE_DIR)
+		}
+
+		var sbom structs.SBOM
+		if os.Getenv("BP_UBI_SBOM") == "true" {
+			sbom, err = utils.GetSBOM(dependencyManager.GenerateBillOfMaterials(dependency), distroProfile.Distro.Name)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+			logger.Process("Writing the SBOM of the installed packages to %s", sbom.Path)
+		}
+
+		caCertificates, err := utils.GetCACertificates(context.Platform.Path)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		if len(caCertificates) > 0 {
+			logger.Process("Adding %d CA certificates from service bindings", len(caCertificates))
+		}
+
+		repositoriesDir := os.Getenv("BP_UBI_REPOSITORIES_DIR")
+		if repositoriesDir != "" {
+			if !filepath.IsLocal(repositoriesDir) {
+				return packit.GenerateResult{}, fmt.Errorf("BP_UBI_REPOSITORIES_DIR must be a path inside the application directory: %s", repositoriesDir)
+			}
+			repositoriesDir = filepath.Join(context.WorkingDir, repositoriesDir)
+		}
+
+		allowUnsignedRepositories := os.Getenv("BP_UBI_ALLOW_UNSIGNED_REPOSITORIES") == "true"
+		enforceGpgcheck := os.Getenv("BP_UBI_ENFORCE_GPGCHECK") == "true"
+		if enforceGpgcheck {
+			if allowUnsignedRepositories {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_ALLOW_UNSIGNED_REPOSITORIES can not be used together with BP_UBI_ENFORCE_GPGCHECK")
+			}
+			logger.Process("Enforcing the GPG signature check of the installed packages")
+		}
+
+		repositories, err := utils.GetRepositories(context.Platform.Path, repositoriesDir, allowUnsignedRepositories)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
+		if enforceGpgcheck {
+			for _, file := range repositories.Files {
+				content, err := base64.StdEncoding.DecodeString(file.Content)
+				if err != nil {
+					return packit.GenerateResult{}, err
+				}
+				if err := utils.CheckSignaturePolicy(fmt.Sprintf("repository file %s", file.Name), string(content)); err != nil {
+					return packit.GenerateResult{}, packit.Fail.WithMessage("%s", err)
+				}
+			}
+		}
+		if len(repositories.Files) > 0 {
+			logger.Process("Adding %d package repository files and %d GPG keys", len(repositories.Files), len(repositories.GpgKeys))
+		}
+
+		disableDefaultRepositories := os.Getenv("BP_UBI_DISABLE_DEFAULT_REPOSITORIES") == "true"
+		if disableDefaultRepositories {
+			if len(repositories.Files) == 0 {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_DISABLE_DEFAULT_REPOSITORIES requires custom package repositories")
+			}
+			logger.Process("Disabling the default package repositories")
+		}
+
+		rhsmFiles, err := utils.GetRHSMFiles(context.Platform.Path)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		var rhsmRepository structs.File
+		if len(rhsmFiles) > 0 {
+			if len(distroProfile.EntitledRepositories) == 0 {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("the %s service binding can not be used with %s, which has no entitled RHEL repositories", utils.RHSMBindingType, stackId)
+			}
+			rhsmRepository, err = utils.GetRHSMRepositoryFile(rhsmFiles, distroProfile.EntitledRepositories)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+			logger.Process("Using the Red Hat subscription from the %s service binding to install packages", utils.RHSMBindingType)
+			for _, repository := range distroProfile.EntitledRepositories {
+				logger.Subprocess("Enabling entitled repository %s", repository.ID)
+			}
+			if runMode == "extend" {
+				logger.Subprocess("The subscription is not used when extending the run image, as it would be part of the exported image")
+			}
+		}
+
+		buildArgNames, err := utils.GetBuildArgNames(os.Getenv("BP_UBI_BUILD_ARGS"), os.LookupEnv)
+		if err != nil {
+			return packit.GenerateResult{}, fmt.Errorf("failed to parse BP_UBI_BUILD_ARGS: %w", err)
+		}
+
+		buildArgs := []packit.ExtendImageConfigArg{}
+		if len(buildArgNames) > 0 {
+			logger.Process("Passing build arguments to the build image")
+		}
+		for _, name := range buildArgNames {
+			value := os.Getenv(name)
+			buildArgs = append(buildArgs, packit.ExtendImageConfigArg{Name: name, Value: value})
+			logger.Subprocess("%s", utils.FormatBuildArg(name, value))
+		}
+
+		duringBuildPermissions, permissionsSource, err := resolveDuringBuildPermissions()
+		if err != nil {
+			return packit.GenerateResult{}, fmt.Errorf("failed to determine the CNB user: %w", err)
+		}
+		logger.Process("Using the CNB user %d:%d from %s", duringBuildPermissions.CNB_USER_ID, duringBuildPermissions.CNB_GROUP_ID, permissionsSource)
 
-		setSymlinks := utils.GetSymlinks(context.Stack, int(selectedNodeMajorVersion))
+		if openShiftCompat {
+			// OpenShift runs the app with an arbitrary user ID in group 0, so
+			// the app directory the lifecycle exports with the group of the
+			// build has to belong to group 0.
+			if duringBuildPermissions.CNB_GROUP_ID != 0 {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_OPENSHIFT_COMPAT requires the build to run with group 0 so that the application directory belongs to it, but the CNB group is %d", duringBuildPermissions.CNB_GROUP_ID)
+			}
+			if duringBuildPermissions.CNB_USER_HOME == "" {
+				return packit.GenerateResult{}, packit.Fail.WithMessage("BP_UBI_OPENSHIFT_COMPAT requires the CNB user %d to have a home directory in /etc/passwd of the build image", duringBuildPermissions.CNB_USER_ID)
+			}
+		}
 
 		// Generating build.Dockerfile
 		buildDockerfileContent, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
 			NODEJS_VERSION:       selectedNodeMajorVersion,
 			CNB_USER_ID:          duringBuildPermissions.CNB_USER_ID,
 			CNB_GROUP_ID:         duringBuildPermissions.CNB_GROUP_ID,
-			CNB_STACK_ID:         context.Stack,
-			PACKAGES:             requiredPackagesForBuild,
-			SET_SYMLINKS:         setSymlinks,
-			ENABLE_NODEJS_MODULE: utils.ShouldEnableNodejsModule(context.Stack),
+			PACKAGES:             nodeProfile.GetBuildPackages(),
+			SYMLINKS:             nodeProfile.GetSymlinks(),
+			ENABLE_NODEJS_MODULE: distroProfile.EnableNodejsModule,
+			PACKAGE_MANAGER:      packageManager,
+			FIPS:                 fips,
+			CA_CERTIFICATES:      caCertificates,
+			BUILD_ARGS:           buildArgNames,
+			RHSM:                 rhsmFiles,
+			RHSM_REPOSITORY:      rhsmRepository,
+			PACKAGE_CACHE:        packageCache,
+			LABELS:               labels,
+			SBOM:                 sbom,
+			GPGCHECK:             enforceGpgcheck,
+			LOCALE_PACKAGES:      localePackages,
+			LOCALE_ENV:           localeEnv,
+			TIMEZONE_DATA:        timezoneData,
+			FULL_ICU_PACKAGES:    fullICUPackages,
+			VERIFY:               true,
+			VERIFY_NPM:           nodeProfile.ProvidesNpm(),
+
+			REPOSITORIES:                 repositories.Files,
+			GPG_KEYS:                     repositories.GpgKeys,
+			DISABLE_DEFAULT_REPOSITORIES: disableDefaultRepositories,
 		})
 
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
+		runDockerfileProps := structs.RunDockerfileProps{
+			Source:          selectedNodeRunImage,
+			FIPS:            fips,
+			CA_CERTIFICATES: caCertificates,
+			CNB_USER_ID:     duringBuildPermissions.CNB_USER_ID,
+			CNB_GROUP_ID:    duringBuildPermissions.CNB_GROUP_ID,
+			PACKAGE_MANAGER: packageManager,
+			SBOM:            sbom,
+			GPGCHECK:        enforceGpgcheck,
+
+			OPENSHIFT:           openShiftCompat,
+			NSS_WRAPPER_PACKAGE: openShiftNssWrapperPackage,
+			CNB_USER_HOME:       duringBuildPermissions.CNB_USER_HOME,
+			NSS_WRAPPER_SCRIPT:  utils.GetNssWrapperScript(duringBuildPermissions.CNB_USER_HOME),
+			LOCALE_PACKAGES:     localePackages,
+			TIMEZONE_DATA:       timezoneData,
+			FULL_ICU_PACKAGES:   fullICUPackages,
+
+			REPOSITORIES:                 repositories.Files,
+			GPG_KEYS:                     repositories.GpgKeys,
+			DISABLE_DEFAULT_REPOSITORIES: disableDefaultRepositories,
+		}
+
+		if extendRunImage {
+			logger.Process("Extending the run image with Node.js %d", selectedNodeMajorVersion)
+
+			runDockerfileProps = structs.RunDockerfileProps{
+				EXTEND:               true,
+				NODEJS_VERSION:       selectedNodeMajorVersion,
+				CNB_USER_ID:          duringBuildPermissions.CNB_USER_ID,
+				CNB_GROUP_ID:         duringBuildPermissions.CNB_GROUP_ID,
+				PACKAGES:             nodeProfile.GetRunPackages(),
+				SYMLINKS:             nodeProfile.GetRunSymlinks(),
+				ENABLE_NODEJS_MODULE: distroProfile.EnableNodejsModule,
+				PACKAGE_MANAGER:      packageManager,
+				FIPS:                 fips,
+				CA_CERTIFICATES:      caCertificates,
+				SBOM:                 sbom,
+				GPGCHECK:             enforceGpgcheck,
+
+				OPENSHIFT:           openShiftCompat,
+				NSS_WRAPPER_PACKAGE: openShiftNssWrapperPackage,
+				CNB_USER_HOME:       duringBuildPermissions.CNB_USER_HOME,
+				NSS_WRAPPER_SCRIPT:  utils.GetNssWrapperScript(duringBuildPermissions.CNB_USER_HOME),
+				LOCALE_PACKAGES:     localePackages,
+				TIMEZONE_DATA:       timezoneData,
+				FULL_ICU_PACKAGES:   fullICUPackages,
+
+				REPOSITORIES:                 repositories.Files,
+				GPG_KEYS:                     repositories.GpgKeys,
+				DISABLE_DEFAULT_REPOSITORIES: disableDefaultRepositories,
+			}
+		}
+
+		runConfigPath := os.Getenv("BP_UBI_RUN_CONFIG")
+		if runConfigPath != "" {
+			if !filepath.IsLocal(runConfigPath) {
+				return packit.GenerateResult{}, fmt.Errorf("BP_UBI_RUN_CONFIG must be a path inside the application directory: %s", runConfigPath)
+			}
+			runConfigPath = filepath.Join(context.WorkingDir, runConfigPath)
+		}
+
+		runEnv, runUser, err := utils.GetRunConfig(runConfigPath, os.Environ())
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+		// LANG and TZ of the locale settings are defaults the run image
+		// configuration can override.
+		for _, variable := range localeEnv {
+			if !slices.ContainsFunc(runEnv, func(v structs.EnvVar) bool { return v.Name == variable.Name }) {
+				runEnv = append(runEnv, variable)
+			}
+		}
+		slices.SortFunc(runEnv, func(a, b structs.EnvVar) int { return strings.Compare(a.Name, b.Name) })
+		if len(runEnv) > 0 {
+			logger.Process("Setting %d environment variables in the run image", len(runEnv))
+		}
+		for i, variable := range runEnv {
+			// NODE_OPTIONS would otherwise replace the one enabling FIPS mode.
+			if fips && variable.Name == "NODE_OPTIONS" && !strings.Contains(variable.Value, "--enable-fips") {
+				runEnv[i].Value = strings.TrimSpace("--enable-fips " + variable.Value)
+			}
+			logger.Subprocess("%s=%s", variable.Name, runEnv[i].Value)
+		}
+		if runUser != "" {
+			logger.Process("Running the processes of the run image as user %s", runUser)
+		}
+		runDockerfileProps.ENV = runEnv
+		runDockerfileProps.RUN_USER = runUser
+
+		// Any instruction besides FROM makes the platform extend the run image
+		// instead of only switching to it, so a switched run image only gets
+		// the labels when they are asked for.
+		if extendRunImage || fips || openShiftCompat || len(localePackages) > 0 || len(fullICUPackages) > 0 || len(caCertificates) > 0 || len(runEnv) > 0 || runUser != "" || os.Getenv("BP_UBI_RUN_IMAGE_LABELS") == "true" {
+			runDockerfileProps.LABELS = labels
+		}
+
 		// Generating run.Dockerfile
-		runDockerfileContent, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
-			Source: selectedNodeRunImage,
-		})
+		runDockerfileContent, err := utils.GenerateRunDockerfile(runDockerfileProps)
 
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
+		if enforceGpgcheck {
+			if err := utils.CheckSignaturePolicy("the generated build.Dockerfile", buildDockerfileContent); err != nil {
+				return packit.GenerateResult{}, err
+			}
+			if err := utils.CheckSignaturePolicy("the generated run.Dockerfile", runDockerfileContent); err != nil {
+				return packit.GenerateResult{}, err
+			}
+		}
+
 		return packit.GenerateResult{
-			ExtendConfig:    packit.ExtendConfig{Build: packit.ExtendImageConfig{Args: []packit.ExtendImageConfigArg{}}},
+			ExtendConfig:    packit.ExtendConfig{Build: packit.ExtendImageConfig{Args: buildArgs}},
 			BuildDockerfile: strings.NewReader(buildDockerfileContent),
 			RunDockerfile:   strings.NewReader(runDockerfileContent),
 		}, nil
 	}
 }
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
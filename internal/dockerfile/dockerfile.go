@@ -0,0 +1,251 @@
+// Package dockerfile models the instructions of the generated Dockerfiles,
+// so that every feature adding to them is validated, escaped and rendered
+// the same way.
+package dockerfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	labelKey     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	plainValue   = regexp.MustCompile(`^[A-Za-z0-9_./:,+=@%-]+$`)
+
+	// userName is a user name or UID, optionally followed by a group name or
+	// GID, without anything the builder would substitute.
+	userName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+)
+
+// Instruction is a single instruction of a Dockerfile.
+type Instruction interface {
+	render() (string, error)
+}
+
+// Dockerfile renders the instructions in the order they were added, with an
+// empty line between the groups passed to Add.
+type Dockerfile struct {
+	groups [][]Instruction
+}
+
+// Add appends a group of instructions that are rendered on consecutive
+// lines. Empty groups are left out.
+func (d *Dockerfile) Add(instructions ...Instruction) {
+	if len(instructions) > 0 {
+		d.groups = append(d.groups, instructions)
+	}
+}
+
+// Render returns the Dockerfile, or the error of the first instruction that
+// is not valid.
+func (d Dockerfile) Render() (string, error) {
+	groups := make([]string, 0, len(d.groups))
+	for _, group := range d.groups {
+		lines := make([]string, 0, len(group))
+		for _, instruction := range group {
+			line, err := instruction.render()
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		groups = append(groups, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(groups, "\n\n"), nil
+}
+
+// From starts a build stage from Image, named Name when it is set.
+type From struct {
+	Image string
+	Name  string
+}
+
+func (f From) render() (string, error) {
+	if err := checkWord("FROM image", f.Image); err != nil {
+		return "", err
+	}
+	if f.Name == "" {
+		return "FROM " + f.Image, nil
+	}
+	if err := checkWord("FROM stage name", f.Name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("FROM %s AS %s", f.Image, f.Name), nil
+}
+
+// Arg declares a build argument.
+type Arg string
+
+func (a Arg) render() (string, error) {
+	if !variableName.MatchString(string(a)) {
+		return "", fmt.Errorf("invalid ARG name '%s'", string(a))
+	}
+	return "ARG " + string(a), nil
+}
+
+// Run executes Commands with the shell, chained with && so that the first
+// failing one fails the build. A command can only span several lines by
+// ending them with a backslash.
+type Run struct {
+	Commands []string
+}
+
+func (r Run) render() (string, error) {
+	if len(r.Commands) == 0 {
+		return "", fmt.Errorf("RUN needs at least one command")
+	}
+
+	for _, command := range r.Commands {
+		if strings.TrimSpace(command) == "" {
+			return "", fmt.Errorf("RUN commands must not be empty")
+		}
+		if strings.ContainsAny(strings.ReplaceAll(command, "\\\n", ""), "\r\n") {
+			return "", fmt.Errorf("RUN command spans several lines without continuing them: %q", command)
+		}
+	}
+
+	return "RUN " + strings.Join(r.Commands, " && \\\n    "), nil
+}
+
+// RunExec executes Argv without a shell.
+type RunExec []string
+
+func (r RunExec) render() (string, error) {
+	if len(r) == 0 || r[0] == "" {
+		return "", fmt.Errorf("RUN needs an executable")
+	}
+
+	args := make([]string, 0, len(r))
+	for _, arg := range r {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(arg); err != nil {
+			return "", err
+		}
+		args = append(args, strings.TrimSuffix(buf.String(), "\n"))
+	}
+
+	return "RUN [" + strings.Join(args, ", ") + "]", nil
+}
+
+// KeyValue is a variable of Env or a label of Label.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Env sets environment variables. Values are taken literally, and only
+// quoted when they contain more than letters, digits and path characters.
+type Env []KeyValue
+
+func (e Env) render() (string, error) {
+	if len(e) == 0 {
+		return "", fmt.Errorf("ENV needs at least one variable")
+	}
+
+	pairs := make([]string, 0, len(e))
+	for _, variable := range e {
+		if !variableName.MatchString(variable.Key) {
+			return "", fmt.Errorf("invalid ENV name '%s'", variable.Key)
+		}
+		if err := checkValue("ENV "+variable.Key, variable.Value); err != nil {
+			return "", err
+		}
+
+		value := variable.Value
+		if !plainValue.MatchString(value) {
+			value = Quote(value)
+		}
+		pairs = append(pairs, variable.Key+"="+value)
+	}
+
+	return "ENV " + strings.Join(pairs, " \\\n    "), nil
+}
+
+// Label adds labels to the image, with their values always quoted.
+type Label []KeyValue
+
+func (l Label) render() (string, error) {
+	if len(l) == 0 {
+		return "", fmt.Errorf("LABEL needs at least one label")
+	}
+
+	pairs := make([]string, 0, len(l))
+	for _, label := range l {
+		if !labelKey.MatchString(label.Key) {
+			return "", fmt.Errorf("invalid LABEL key '%s'", label.Key)
+		}
+		if err := checkValue("LABEL "+label.Key, label.Value); err != nil {
+			return "", err
+		}
+		pairs = append(pairs, label.Key+"="+Quote(label.Value))
+	}
+
+	return "LABEL " + strings.Join(pairs, " \\\n      "), nil
+}
+
+// User sets the user, and optionally the group, the following instructions
+// and the processes of the image run as.
+type User string
+
+func (u User) render() (string, error) {
+	if !userName.MatchString(string(u)) {
+		return "", fmt.Errorf("invalid USER '%s'", string(u))
+	}
+	return "USER " + string(u), nil
+}
+
+// Copy copies Sources to Dest, from the build stage From when it is set.
+type Copy struct {
+	From    string
+	Sources []string
+	Dest    string
+}
+
+func (c Copy) render() (string, error) {
+	if len(c.Sources) == 0 {
+		return "", fmt.Errorf("COPY needs at least one source")
+	}
+
+	words := []string{"COPY"}
+	if c.From != "" {
+		if err := checkWord("COPY stage", c.From); err != nil {
+			return "", err
+		}
+		words = append(words, "--from="+c.From)
+	}
+	for _, path := range append(append([]string{}, c.Sources...), c.Dest) {
+		if err := checkWord("COPY path", path); err != nil {
+			return "", err
+		}
+		words = append(words, path)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// Quote returns value in double quotes, escaped so that Dockerfile
+// instructions take it literally, without substituting variables.
+func Quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(value) + `"`
+}
+
+func checkWord(description, word string) error {
+	if word == "" || strings.ContainsAny(word, " \t\r\n") {
+		return fmt.Errorf("invalid %s '%s'", description, word)
+	}
+	return nil
+}
+
+func checkValue(description, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("the value of %s must not span several lines", description)
+	}
+	return nil
+}
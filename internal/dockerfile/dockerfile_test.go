@@ -0,0 +1,191 @@
+package dockerfile_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/dockerfile"
+	"github.com/sclevine/spec"
+)
+
+func testDockerfile(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	render := func(instructions ...dockerfile.Instruction) (string, error) {
+		var file dockerfile.Dockerfile
+		file.Add(instructions...)
+		return file.Render()
+	}
+
+	context("Render", func() {
+
+		it("should separate the groups of instructions with an empty line", func() {
+			var file dockerfile.Dockerfile
+			file.Add(dockerfile.Arg("base_image"), dockerfile.From{Image: "${base_image}"})
+			file.Add()
+			file.Add(dockerfile.User("root"))
+			file.Add(dockerfile.Label{{Key: "io.paketo.example", Value: "value"}}, dockerfile.User("1000:1000"))
+
+			output, err := file.Render()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+LABEL io.paketo.example="value"
+USER 1000:1000`))
+		})
+
+		it("should fail with the error of the first invalid instruction", func() {
+			var file dockerfile.Dockerfile
+			file.Add(dockerfile.From{Image: "ubi"})
+			file.Add(dockerfile.Arg("1NVALID"), dockerfile.User(""))
+
+			_, err := file.Render()
+			Expect(err).To(MatchError("invalid ARG name '1NVALID'"))
+		})
+	})
+
+	context("From", func() {
+
+		it("should name the build stage", func() {
+			output, err := render(dockerfile.From{Image: "registry.access.redhat.com/ubi9/ubi-minimal", Name: "nodejs-runtime"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("FROM registry.access.redhat.com/ubi9/ubi-minimal AS nodejs-runtime"))
+		})
+
+		it("should fail for an image with whitespace", func() {
+			_, err := render(dockerfile.From{Image: "ubi\nRUN id"})
+			Expect(err).To(MatchError("invalid FROM image 'ubi\nRUN id'"))
+		})
+	})
+
+	context("Run", func() {
+
+		it("should chain the commands and continue them on the next lines", func() {
+			output, err := render(dockerfile.Run{Commands: []string{
+				"microdnf install -y nodejs",
+				"(node -v || \\\n    (echo failed >&2 && exit 1))",
+				"microdnf clean all",
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`RUN microdnf install -y nodejs && \
+    (node -v || \
+    (echo failed >&2 && exit 1)) && \
+    microdnf clean all`))
+		})
+
+		it("should fail for a command that ends the instruction early", func() {
+			_, err := render(dockerfile.Run{Commands: []string{"echo a\nUSER root"}})
+			Expect(err).To(MatchError(ContainSubstring("RUN command spans several lines without continuing them")))
+		})
+
+		it("should fail without commands", func() {
+			_, err := render(dockerfile.Run{})
+			Expect(err).To(MatchError("RUN needs at least one command"))
+
+			_, err = render(dockerfile.Run{Commands: []string{" "}})
+			Expect(err).To(MatchError("RUN commands must not be empty"))
+		})
+	})
+
+	context("RunExec", func() {
+
+		it("should render the arguments as a JSON array", func() {
+			output, err := render(dockerfile.RunExec{"/usr/bin/node", "-e", `console.log("<$HOME>")`})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`RUN ["/usr/bin/node", "-e", "console.log(\"<$HOME>\")"]`))
+		})
+
+		it("should fail without an executable", func() {
+			_, err := render(dockerfile.RunExec{})
+			Expect(err).To(MatchError("RUN needs an executable"))
+		})
+	})
+
+	context("Env", func() {
+
+		it("should only quote the values that need it", func() {
+			output, err := render(dockerfile.Env{
+				{Key: "NODE_ENV", Value: "production"},
+				{Key: "NODE_OPTIONS", Value: `--title="$APP" --max-old-space-size=512`},
+				{Key: "EMPTY", Value: ""},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ENV NODE_ENV=production \
+    NODE_OPTIONS="--title=\"\$APP\" --max-old-space-size=512" \
+    EMPTY=""`))
+		})
+
+		it("should fail for an invalid name or a multiline value", func() {
+			_, err := render(dockerfile.Env{{Key: "NODE-ENV", Value: "production"}})
+			Expect(err).To(MatchError("invalid ENV name 'NODE-ENV'"))
+
+			_, err = render(dockerfile.Env{{Key: "NODE_ENV", Value: "production\nUSER root"}})
+			Expect(err).To(MatchError("the value of ENV NODE_ENV must not span several lines"))
+		})
+	})
+
+	context("Label", func() {
+
+		it("should always quote the values", func() {
+			output, err := render(dockerfile.Label{
+				{Key: "io.paketo.ubi-nodejs.build-inputs", Value: "sha256:1234"},
+				{Key: "org.opencontainers.image.title", Value: `Node.js "$VERSION"`},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`LABEL io.paketo.ubi-nodejs.build-inputs="sha256:1234" \
+      org.opencontainers.image.title="Node.js \"\$VERSION\""`))
+		})
+
+		it("should fail for an invalid key", func() {
+			_, err := render(dockerfile.Label{{Key: "io.paketo example", Value: "value"}})
+			Expect(err).To(MatchError("invalid LABEL key 'io.paketo example'"))
+		})
+	})
+
+	context("Copy", func() {
+
+		it("should copy from a build stage", func() {
+			output, err := render(dockerfile.Copy{From: "nodejs-runtime", Sources: []string{"/rootfs/"}, Dest: "/"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("COPY --from=nodejs-runtime /rootfs/ /"))
+		})
+
+		it("should fail without a source or a destination", func() {
+			_, err := render(dockerfile.Copy{Dest: "/"})
+			Expect(err).To(MatchError("COPY needs at least one source"))
+
+			_, err = render(dockerfile.Copy{Sources: []string{"/rootfs/"}})
+			Expect(err).To(MatchError("invalid COPY path ''"))
+		})
+	})
+
+	context("User", func() {
+
+		it("should fail for a user with whitespace", func() {
+			_, err := render(dockerfile.User("1000 1000"))
+			Expect(err).To(MatchError("invalid USER '1000 1000'"))
+		})
+
+		it("should fail for a user the builder would substitute", func() {
+			_, err := render(dockerfile.User("$(id)"))
+			Expect(err).To(MatchError("invalid USER '$(id)'"))
+
+			_, err = render(dockerfile.User("${HOME}:0"))
+			Expect(err).To(MatchError("invalid USER '${HOME}:0'"))
+		})
+
+		it("should render a user name or UID with an optional group", func() {
+			for _, user := range []string{"root", "1002:0", "cnb:cnb", "node.js_user-1"} {
+				output, err := render(dockerfile.User(user))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(Equal("USER " + user))
+			}
+		})
+	})
+}
@@ -0,0 +1,14 @@
+package dockerfile_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitDockerfile(t *testing.T) {
+	suite := spec.New("dockerfile-ubi-nodejs-extension", spec.Report(report.Terminal{}))
+	suite("Dockerfile", testDockerfile)
+	suite.Run(t)
+}
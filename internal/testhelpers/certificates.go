@@ -0,0 +1,59 @@
+package testhelpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func GenerateCACertificate(commonName string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// WriteServiceBinding creates a service binding of the given type in the
+// bindings directory, with one file per entry.
+func WriteServiceBinding(bindingsDir, name, bindingType string, entries map[string][]byte) error {
+	bindingDir := filepath.Join(bindingsDir, name)
+	if err := os.MkdirAll(bindingDir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(bindingDir, "type"), []byte(bindingType), 0644); err != nil {
+		return err
+	}
+
+	for entry, content := range entries {
+		if err := os.WriteFile(filepath.Join(bindingDir, entry), content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package testhelpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type OCILayout struct {
+	Path      string
+	manifests []map[string]interface{}
+}
+
+func NewOCILayout(path string) (*OCILayout, error) {
+	if err := os.MkdirAll(filepath.Join(path, "blobs", "sha256"), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(path, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		return nil, err
+	}
+
+	layout := &OCILayout{Path: path}
+	return layout, layout.writeIndex()
+}
+
+// WriteBlob stores the content in the layout and returns its digest.
+func (l *OCILayout) WriteBlob(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	if err := os.WriteFile(filepath.Join(l.Path, "blobs", "sha256", hash), content, 0644); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hash, nil
+}
+
+// AddImage writes an image with the given config and no layers, tags it with
+// refName and returns the manifest digest.
+func (l *OCILayout) AddImage(refName string, config map[string]interface{}) (string, error) {
+	configContent, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	configDigest, err := l.WriteBlob(configContent)
+	if err != nil {
+		return "", err
+	}
+
+	return l.addManifest(refName, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    configDigest,
+			"size":      len(configContent),
+		},
+		"layers": []interface{}{},
+	})
+}
+
+// AddSignature signs the image digest with the given key the same way cosign
+// does and stores the signature next to the image.
+func (l *OCILayout) AddSignature(name, digest string, key crypto.Signer, annotations map[string]string) error {
+	return l.AddSignatureWithPayloadDigest(name, digest, digest, key, annotations)
+}
+
+// AddSignatureWithPayloadDigest stores a signature for digest whose signed
+// payload claims payloadDigest instead.
+func (l *OCILayout) AddSignatureWithPayloadDigest(name, digest, payloadDigest string, key crypto.Signer, annotations map[string]string) error {
+	return l.addSignature(name, name, digest, payloadDigest, key, func(_, _ []byte) (map[string]string, error) {
+		return annotations, nil
+	})
+}
+
+// AddSignatureForReference stores a signature for digest whose signed
+// payload claims the image dockerReference instead of name.
+func (l *OCILayout) AddSignatureForReference(name, dockerReference, digest string, key crypto.Signer) error {
+	return l.addSignature(name, dockerReference, digest, digest, key, func(_, _ []byte) (map[string]string, error) {
+		return nil, nil
+	})
+}
+
+// AddKeylessSignature stores a signature made with the key of the signing
+// certificate, together with a Rekor bundle of the log key that integrated
+// it at the given time.
+func (l *OCILayout) AddKeylessSignature(name, digest string, key crypto.Signer, certificate string, logKey crypto.Signer, integratedTime time.Time) error {
+	return l.addSignature(name, name, digest, digest, key, func(payload, signature []byte) (map[string]string, error) {
+		bundle, err := RekorBundle(logKey, payload, signature, []byte(certificate), integratedTime)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{
+			"dev.sigstore.cosign/certificate": certificate,
+			"dev.sigstore.cosign/bundle":      bundle,
+		}, nil
+	})
+}
+
+func (l *OCILayout) addSignature(name, dockerReference, digest, payloadDigest string, key crypto.Signer, annotations func(payload, signature []byte) (map[string]string, error)) error {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, dockerReference, payloadDigest))
+
+	payloadBlobDigest, err := l.WriteBlob(payload)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	signature, err := key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	layerAnnotations := map[string]string{
+		"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(signature),
+	}
+	extraAnnotations, err := annotations(payload, signature)
+	if err != nil {
+		return err
+	}
+	for k, v := range extraAnnotations {
+		layerAnnotations[k] = v
+	}
+
+	configDigest, err := l.WriteBlob([]byte("{}"))
+	if err != nil {
+		return err
+	}
+
+	_, err = l.addManifest(fmt.Sprintf("%s:%s.sig", name, strings.Replace(digest, ":", "-", 1)), map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    configDigest,
+			"size":      2,
+		},
+		"layers": []interface{}{
+			map[string]interface{}{
+				"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+				"digest":      payloadBlobDigest,
+				"size":        len(payload),
+				"annotations": layerAnnotations,
+			},
+		},
+	})
+
+	return err
+}
+
+func (l *OCILayout) addManifest(refName string, manifest map[string]interface{}) (string, error) {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := l.WriteBlob(content)
+	if err != nil {
+		return "", err
+	}
+
+	l.manifests = append(l.manifests, map[string]interface{}{
+		"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+		"digest":      digest,
+		"size":        len(content),
+		"annotations": map[string]string{"org.opencontainers.image.ref.name": refName},
+	})
+
+	return digest, l.writeIndex()
+}
+
+func (l *OCILayout) writeIndex() error {
+	content, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests":     append([]map[string]interface{}{}, l.manifests...),
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(l.Path, "index.json"), content, 0644)
+}
+
+// GenerateSigningKey returns a new ECDSA P-256 key and writes its PEM encoded
+// public key to publicKeyPath.
+func GenerateSigningKey(publicKeyPath string) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	content := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+	return key, os.WriteFile(publicKeyPath, content, 0644)
+}
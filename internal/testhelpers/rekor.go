@@ -0,0 +1,65 @@
+package testhelpers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// RekorBundle returns the cosign bundle annotation of a transparency log
+// entry for the signature, integrated at the given time and signed with the
+// log key.
+func RekorBundle(logKey crypto.Signer, payload, signature, certificate []byte, integratedTime time.Time) (string, error) {
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			},
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(signature),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(certificate)},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	keyDER, err := x509.MarshalPKIXPublicKey(logKey.Public())
+	if err != nil {
+		return "", err
+	}
+	logID := sha256.Sum256(keyDER)
+
+	bundlePayload := struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(body), integratedTime.Unix(), hex.EncodeToString(logID[:]), 1}
+
+	canonicalPayload, err := json.Marshal(bundlePayload)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(canonicalPayload)
+	timestamp, err := logKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	bundle, err := json.Marshal(map[string]interface{}{
+		"SignedEntryTimestamp": base64.StdEncoding.EncodeToString(timestamp),
+		"Payload":              bundlePayload,
+	})
+	return string(bundle), err
+}
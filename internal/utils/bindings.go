@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+const CACertificatesBindingType = "ca-certificates"
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// GetCACertificates returns the certificates of all the ca-certificates
+// service bindings. Every entry of a binding is a PEM file with one or more
+// certificates.
+func GetCACertificates(platformPath string) ([]structs.File, error) {
+	bindings, err := servicebindings.NewResolver().Resolve(CACertificatesBindingType, "", platformPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s bindings: %w", CACertificatesBindingType, err)
+	}
+
+	var certificates []structs.File
+	for _, binding := range bindings {
+		for _, name := range sortedEntryNames(binding) {
+			content, err := binding.Entries[name].ReadBytes()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read entry %s of binding %s: %w", name, binding.Name, err)
+			}
+
+			if !containsCertificate(content) {
+				return nil, fmt.Errorf("entry %s of binding %s does not contain a PEM encoded certificate", name, binding.Name)
+			}
+
+			certificates = append(certificates, structs.File{
+				Name:    bindingFileName(binding.Name, name, ".pem"),
+				Content: base64.StdEncoding.EncodeToString(content),
+			})
+		}
+	}
+
+	return certificates, nil
+}
+
+func sortedEntryNames(binding servicebindings.Binding) []string {
+	var names []string
+	for name := range binding.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bindingFileName returns a file name for a binding entry that is safe to
+// use in a Dockerfile and does not clash with the entries of other bindings.
+func bindingFileName(bindingName, entryName, extension string) string {
+	name := unsafeFileNameCharacters.ReplaceAllString(bindingName+"-"+entryName, "_")
+	if !strings.HasSuffix(name, extension) {
+		name += extension
+	}
+	return name
+}
+
+func containsCertificate(content []byte) bool {
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return false
+		}
+		if block.Type == "CERTIFICATE" {
+			return true
+		}
+	}
+}
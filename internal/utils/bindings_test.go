@@ -0,0 +1,84 @@
+package utils_test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetCACertificates(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		platformDir string
+		bindingsDir string
+		certificate []byte
+	)
+
+	it.Before(func() {
+		platformDir = t.TempDir()
+		bindingsDir = filepath.Join(platformDir, "bindings")
+
+		// The resolver prefers these over the platform directory, even when empty
+		for _, name := range []string{"SERVICE_BINDING_ROOT", "CNB_BINDINGS", "VCAP_SERVICES"} {
+			t.Setenv(name, "")
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+
+		var err error
+		certificate, err = testhelpers.GenerateCACertificate("Corporate Root CA")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it("should return no certificates without bindings", func() {
+		certificates, err := utils.GetCACertificates(platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificates).To(BeEmpty())
+	})
+
+	it("should return the entries of the ca-certificates bindings", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "corporate-ca", "ca-certificates", map[string][]byte{
+			"root.crt": certificate,
+			"proxy":    certificate,
+		})).To(Succeed())
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "other", "maven", map[string][]byte{
+			"settings.xml": []byte("<settings/>"),
+		})).To(Succeed())
+
+		certificates, err := utils.GetCACertificates(platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificates).To(Equal([]structs.File{
+			{Name: "corporate-ca-proxy.pem", Content: base64.StdEncoding.EncodeToString(certificate)},
+			{Name: "corporate-ca-root.crt.pem", Content: base64.StdEncoding.EncodeToString(certificate)},
+		}))
+	})
+
+	it("should read the bindings from SERVICE_BINDING_ROOT", func() {
+		serviceBindingRoot := t.TempDir()
+		t.Setenv("SERVICE_BINDING_ROOT", serviceBindingRoot)
+		Expect(testhelpers.WriteServiceBinding(serviceBindingRoot, "my ca", "ca-certificates", map[string][]byte{
+			"ca.pem": certificate,
+		})).To(Succeed())
+
+		certificates, err := utils.GetCACertificates(platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificates).To(HaveLen(1))
+		Expect(certificates[0].Name).To(Equal("my_ca-ca.pem"))
+	})
+
+	it("should fail for an entry that is not a PEM encoded certificate", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "corporate-ca", "ca-certificates", map[string][]byte{
+			"root.crt": []byte("not a certificate"),
+		})).To(Succeed())
+
+		_, err := utils.GetCACertificates(platformDir)
+		Expect(err).To(MatchError("entry root.crt of binding corporate-ca does not contain a PEM encoded certificate"))
+	})
+}
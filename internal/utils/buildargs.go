@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ProxyBuildArgs are passed to the build image whenever they are set.
+var ProxyBuildArgs = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"}
+
+var buildArgName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GetBuildArgNames returns the names of the proxy variables and of the
+// variables in the comma or space separated allowlist that are set in the
+// environment, in that order.
+func GetBuildArgNames(allowlist string, lookupEnv func(string) (string, bool)) ([]string, error) {
+	names := slices.Clone(ProxyBuildArgs)
+	for _, name := range strings.FieldsFunc(allowlist, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !buildArgName.MatchString(name) {
+			return nil, fmt.Errorf("invalid build argument name '%s'", name)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	var setNames []string
+	for _, name := range names {
+		if value, ok := lookupEnv(name); ok && value != "" {
+			setNames = append(setNames, name)
+		}
+	}
+
+	return setNames, nil
+}
+
+// FormatBuildArg returns the build argument to be logged. The credentials of
+// proxy URLs are masked and the values of other variables are left out, as
+// they may hold secrets.
+func FormatBuildArg(name string, value string) string {
+	if !slices.Contains(ProxyBuildArgs, name) {
+		return name
+	}
+
+	return fmt.Sprintf("%s=%s", name, maskURLCredentials(value))
+}
+
+func maskURLCredentials(value string) string {
+	var masked []string
+	for _, proxy := range strings.Split(value, ",") {
+		scheme, rest, found := strings.Cut(proxy, "://")
+		if !found {
+			scheme, rest = "", proxy
+		}
+
+		host, _, _ := strings.Cut(rest, "/")
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			rest = "***" + rest[at:]
+		}
+
+		if found {
+			rest = scheme + "://" + rest
+		}
+		masked = append(masked, rest)
+	}
+
+	return strings.Join(masked, ",")
+}
@@ -0,0 +1,65 @@
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testBuildArgs(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect    = NewWithT(t).Expect
+		env       map[string]string
+		lookupEnv = func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+	)
+
+	context("GetBuildArgNames", func() {
+
+		it.Before(func() {
+			env = map[string]string{
+				"HTTPS_PROXY":  "http://proxy.example.com:3128",
+				"no_proxy":     "localhost,.example.com",
+				"HTTP_PROXY":   "",
+				"NPM_REGISTRY": "https://npm.example.com",
+				"NOT_LISTED":   "value",
+			}
+		})
+
+		it("should return the proxy variables that are set", func() {
+			names, err := utils.GetBuildArgNames("", lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(Equal([]string{"HTTPS_PROXY", "no_proxy"}))
+		})
+
+		it("should add the variables of the allowlist", func() {
+			names, err := utils.GetBuildArgNames("NPM_REGISTRY, MISSING,HTTPS_PROXY", lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(Equal([]string{"HTTPS_PROXY", "no_proxy", "NPM_REGISTRY"}))
+		})
+
+		it("should fail for an invalid variable name", func() {
+			_, err := utils.GetBuildArgNames("NPM_REGISTRY,1NVALID", lookupEnv)
+			Expect(err).To(MatchError("invalid build argument name '1NVALID'"))
+		})
+	})
+
+	context("FormatBuildArg", func() {
+
+		it("should mask the credentials of proxy URLs", func() {
+			Expect(utils.FormatBuildArg("HTTP_PROXY", "http://user:p@ss@proxy.example.com:3128/path")).To(Equal("HTTP_PROXY=http://***@proxy.example.com:3128/path"))
+			Expect(utils.FormatBuildArg("https_proxy", "user:secret@proxy.example.com:3128")).To(Equal("https_proxy=***@proxy.example.com:3128"))
+			Expect(utils.FormatBuildArg("HTTPS_PROXY", "http://proxy.example.com:3128")).To(Equal("HTTPS_PROXY=http://proxy.example.com:3128"))
+			Expect(utils.FormatBuildArg("NO_PROXY", "localhost,.example.com")).To(Equal("NO_PROXY=localhost,.example.com"))
+		})
+
+		it("should leave out the value of other variables", func() {
+			Expect(utils.FormatBuildArg("NPM_TOKEN", "secret")).To(Equal("NPM_TOKEN"))
+		})
+	})
+}
@@ -0,0 +1,503 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/dockerfile"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+var (
+	packageName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+-]*$`)
+
+	// symlinkPath is an absolute path whose components are package file
+	// names, so that it can not be expanded or split by the shell.
+	symlinkPath = regexp.MustCompile(`^(/[A-Za-z0-9_][A-Za-z0-9._+-]*)+$`)
+)
+
+const (
+	checkSigningKeys = `(rpm -q gpg-pubkey > /dev/null 2>&1 || ls /etc/pki/rpm-gpg/RPM-GPG-KEY-* > /dev/null 2>&1 || \
+    (echo "No RPM signing keys found in the image to check the packages with" >&2 && exit 1))`
+
+	listInstalledPackages = `rpm -qa --qf '%{NEVRA}\n' > /tmp/rpms-before`
+
+	enableFips = "update-crypto-policies --set FIPS"
+
+	checkFips = `node -p "crypto.getFips()" | grep -qx 1 || \
+    (echo "FIPS mode could not be enabled for Node.js" >&2 && exit 1)`
+
+	checkFullICU = `node -e "process.exit(new Intl.DateTimeFormat('es', { month: 'long' }).format(new Date(9e8)) === 'enero' ? 0 : 1)" || \
+    (echo "Full ICU data is not available to Node.js" >&2 && exit 1)`
+)
+
+var (
+	// recordNodePackage asks rpm which package owns the node on the PATH, so
+	// that it holds whatever the profile installed it as.
+	recordNodePackage = `mkdir -p ` + path.Dir(constants.NODE_PACKAGE_PATH) + ` && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > ` + constants.NODE_PACKAGE_PATH
+
+	// nodePackageLabel points at the file the installed Node.js package is
+	// recorded in, as labels can only carry what is known before the build.
+	nodePackageLabel = dockerfile.KeyValue{Key: constants.LABEL_NAMESPACE + ".node.package-file", Value: constants.NODE_PACKAGE_PATH}
+
+	caCertificatesEnv = dockerfile.KeyValue{Key: "NODE_EXTRA_CA_CERTS", Value: "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"}
+
+	fipsEnv = []dockerfile.KeyValue{
+		{Key: "OPENSSL_FORCE_FIPS_MODE", Value: "1"},
+		{Key: "NODE_OPTIONS", Value: "--enable-fips"},
+	}
+)
+
+// buildDockerfile installs the packages of the build image in a single RUN
+// instruction, so that the image only depends on the props.
+func buildDockerfile(props structs.BuildDockerfileProps) (dockerfile.Dockerfile, error) {
+	var build dockerfile.Dockerfile
+	pm := props.PACKAGE_MANAGER
+
+	var extraPackages []string
+	if props.FIPS {
+		extraPackages = append(extraPackages, "crypto-policies-scripts")
+	}
+	packages, err := packageList(props.PACKAGES, props.FULL_ICU_PACKAGES, props.LOCALE_PACKAGES, extraPackages)
+	if err != nil {
+		return dockerfile.Dockerfile{}, err
+	}
+	module, err := moduleStream(props.ENABLE_NODEJS_MODULE, props.NODEJS_VERSION)
+	if err != nil {
+		return dockerfile.Dockerfile{}, err
+	}
+	symlinks, err := symlinkCommands(props.SYMLINKS)
+	if err != nil {
+		return dockerfile.Dockerfile{}, err
+	}
+
+	build.Add(dockerfile.Arg("base_image"), dockerfile.From{Image: "${base_image}"})
+
+	header := []dockerfile.Instruction{dockerfile.User("root")}
+	for _, name := range props.BUILD_ARGS {
+		header = append(header, dockerfile.Arg(name))
+	}
+	build.Add(header...)
+
+	install := dockerfile.Run{}
+	if props.GPGCHECK {
+		install.Commands = append(install.Commands, checkSigningKeys)
+	}
+	if len(props.CA_CERTIFICATES) > 0 {
+		install.Commands = append(install.Commands, trustCACertificates(props.CA_CERTIFICATES)...)
+	}
+	if len(props.REPOSITORIES) > 0 {
+		install.Commands = append(install.Commands, addRepositories(props.REPOSITORIES, props.GPG_KEYS, props.DISABLE_DEFAULT_REPOSITORIES)...)
+	}
+	if len(props.RHSM) > 0 {
+		install.Commands = append(install.Commands, provideSubscription(props.RHSM, props.RHSM_REPOSITORY)...)
+	}
+	if props.SBOM.Path != "" {
+		install.Commands = append(install.Commands, listInstalledPackages)
+	}
+	install.Commands = append(install.Commands, installCommand(pm, module, props.GPGCHECK, props.PACKAGE_CACHE, packages))
+	install.Commands = append(install.Commands, symlinks...)
+	install.Commands = append(install.Commands, recordNodePackage)
+	if props.FIPS {
+		install.Commands = append(install.Commands, enableFips)
+	}
+	if props.TIMEZONE_DATA {
+		install.Commands = append(install.Commands, reinstallTimezoneData(pm, props.GPGCHECK, props.PACKAGE_CACHE))
+	}
+	if props.SBOM.Path != "" {
+		install.Commands = append(install.Commands, writeSBOM(props.SBOM)...)
+	}
+	install.Commands = append(install.Commands, cleanCommand(pm))
+	if len(props.RHSM) > 0 {
+		install.Commands = append(install.Commands, removeSubscription(props.RHSM_REPOSITORY)...)
+	}
+	if props.FIPS {
+		install.Commands = append(install.Commands, "(OPENSSL_FORCE_FIPS_MODE=1 NODE_OPTIONS=--enable-fips "+checkFips+")")
+	}
+	if len(props.FULL_ICU_PACKAGES) > 0 {
+		install.Commands = append(install.Commands, "("+checkFullICU+")")
+	}
+	if props.VERIFY {
+		install.Commands = append(install.Commands, fmt.Sprintf(`(node --version 2>&1 | grep -q '^v%[1]d\.' || \
+    (echo "ubi-nodejs-extension: expected Node.js %[1]d but node --version reports '$(node --version 2>&1)', check the module stream and symlinks of the distro profile" >&2 && exit 1))`, props.NODEJS_VERSION))
+		if props.VERIFY_NPM {
+			install.Commands = append(install.Commands, fmt.Sprintf(`(npm --version > /dev/null 2>&1 || \
+    (echo "ubi-nodejs-extension: npm was installed with Node.js %d but can not be run, check the packages and symlinks of the distro profile" >&2 && exit 1))`, props.NODEJS_VERSION))
+		}
+	}
+	build.Add(install)
+
+	var env dockerfile.Env
+	if len(props.CA_CERTIFICATES) > 0 {
+		env = append(env, caCertificatesEnv)
+	}
+	if props.FIPS {
+		env = append(env, fipsEnv...)
+	}
+	if len(env) > 0 {
+		build.Add(env)
+	}
+	if len(props.LOCALE_ENV) > 0 {
+		build.Add(envVariables(props.LOCALE_ENV))
+	}
+
+	labels := dockerfile.Label{{Key: "io.paketo.ubi-nodejs.build-inputs", Value: props.INPUTS_HASH}, nodePackageLabel}
+	for _, label := range props.LABELS {
+		labels = append(labels, dockerfile.KeyValue{Key: label.Name, Value: label.Value})
+	}
+	build.Add(labels, dockerfile.User(fmt.Sprintf("%d:%d", props.CNB_USER_ID, props.CNB_GROUP_ID)))
+
+	return build, nil
+}
+
+// runDockerfile switches or extends the run image.
+func runDockerfile(props structs.RunDockerfileProps) (dockerfile.Dockerfile, error) {
+	run, err := extendedRunDockerfile(props)
+	if err != nil {
+		return dockerfile.Dockerfile{}, err
+	}
+
+	if len(props.ENV) > 0 {
+		run.Add(envVariables(props.ENV))
+	}
+	if props.RUN_USER != "" {
+		run.Add(dockerfile.User(props.RUN_USER))
+	}
+	if len(props.LABELS) > 0 {
+		var labels dockerfile.Label
+		for _, label := range props.LABELS {
+			labels = append(labels, dockerfile.KeyValue{Key: label.Name, Value: label.Value})
+		}
+		if props.EXTEND {
+			labels = append(labels, nodePackageLabel)
+		}
+		run.Add(labels)
+	}
+
+	return run, nil
+}
+
+// extendedRunDockerfile switches the run image to the Source, or keeps the
+// one of the builder with EXTEND, and installs what the props ask for on top
+// of it.
+func extendedRunDockerfile(props structs.RunDockerfileProps) (dockerfile.Dockerfile, error) {
+	var run dockerfile.Dockerfile
+	pm := props.PACKAGE_MANAGER
+
+	if props.EXTEND {
+		run.Add(dockerfile.Arg("base_image"), dockerfile.From{Image: "${base_image}"})
+	} else {
+		run.Add(dockerfile.From{Image: props.Source})
+	}
+
+	installs := props.EXTEND || props.FIPS || props.OPENSHIFT || len(props.LOCALE_PACKAGES) > 0 || len(props.FULL_ICU_PACKAGES) > 0
+	if !installs && len(props.CA_CERTIFICATES) == 0 {
+		return run, nil
+	}
+
+	run.Add(dockerfile.User("root"))
+	if len(props.CA_CERTIFICATES) > 0 {
+		run.Add(dockerfile.Run{Commands: trustCACertificates(props.CA_CERTIFICATES)})
+		run.Add(dockerfile.Env{caCertificatesEnv})
+	}
+
+	if props.OPENSHIFT && !symlinkPath.MatchString(props.CNB_USER_HOME) {
+		return dockerfile.Dockerfile{}, fmt.Errorf("invalid home directory '%s' of the CNB user", props.CNB_USER_HOME)
+	}
+
+	if installs {
+		var packages, symlinks []string
+		var module string
+		var err error
+		if props.EXTEND {
+			packages, err = packageList(props.PACKAGES, props.FULL_ICU_PACKAGES, props.LOCALE_PACKAGES, nssWrapperPackage(props), fipsPackage(props))
+			if err != nil {
+				return dockerfile.Dockerfile{}, err
+			}
+			module, err = moduleStream(props.ENABLE_NODEJS_MODULE, props.NODEJS_VERSION)
+			if err != nil {
+				return dockerfile.Dockerfile{}, err
+			}
+			symlinks, err = symlinkCommands(props.SYMLINKS)
+		} else {
+			packages, err = packageList(props.FULL_ICU_PACKAGES, props.LOCALE_PACKAGES, fipsPackage(props), nssWrapperPackage(props))
+		}
+		if err != nil {
+			return dockerfile.Dockerfile{}, err
+		}
+
+		install := dockerfile.Run{}
+		if props.GPGCHECK {
+			install.Commands = append(install.Commands, checkSigningKeys)
+		}
+		if len(props.REPOSITORIES) > 0 {
+			install.Commands = append(install.Commands, addRepositories(props.REPOSITORIES, props.GPG_KEYS, props.DISABLE_DEFAULT_REPOSITORIES)...)
+		}
+		if props.SBOM.Path != "" {
+			install.Commands = append(install.Commands, listInstalledPackages)
+		}
+		install.Commands = append(install.Commands, installCommand(pm, module, props.GPGCHECK, false, packages))
+		install.Commands = append(install.Commands, symlinks...)
+		if props.EXTEND {
+			install.Commands = append(install.Commands, recordNodePackage)
+		}
+		if props.FIPS {
+			install.Commands = append(install.Commands, enableFips)
+		}
+		if props.TIMEZONE_DATA {
+			install.Commands = append(install.Commands, reinstallTimezoneData(pm, props.GPGCHECK, false))
+		}
+		if props.SBOM.Path != "" {
+			install.Commands = append(install.Commands, writeSBOM(props.SBOM)...)
+		}
+		install.Commands = append(install.Commands, cleanCommand(pm))
+		if len(props.REPOSITORIES) > 0 {
+			install.Commands = append(install.Commands, removeRepositories(props.REPOSITORIES, props.DISABLE_DEFAULT_REPOSITORIES)...)
+		}
+		if props.FIPS {
+			install.Commands = append(install.Commands, "(OPENSSL_FORCE_FIPS_MODE=1 NODE_OPTIONS=--enable-fips "+checkFips+")")
+		}
+		if len(props.FULL_ICU_PACKAGES) > 0 {
+			install.Commands = append(install.Commands, "("+checkFullICU+")")
+		}
+		if props.OPENSHIFT {
+			install.Commands = append(install.Commands,
+				"mkdir -p /etc/nss_wrapper "+props.CNB_USER_HOME,
+				"cp /etc/passwd /etc/nss_wrapper/passwd",
+				fmt.Sprintf("echo %s | base64 -d > /etc/nss_wrapper/nss_wrapper.sh", props.NSS_WRAPPER_SCRIPT),
+				"chmod 644 /etc/nss_wrapper/nss_wrapper.sh",
+				"chgrp -R 0 /etc/nss_wrapper "+props.CNB_USER_HOME,
+				"chmod -R g=u /etc/nss_wrapper "+props.CNB_USER_HOME,
+			)
+		}
+		run.Add(install)
+	}
+
+	if props.FIPS {
+		run.Add(dockerfile.Env(fipsEnv))
+	}
+	if props.OPENSHIFT {
+		run.Add(nssWrapperEnv(props.CNB_USER_HOME))
+	}
+
+	run.Add(dockerfile.User(fmt.Sprintf("%d:%d", props.CNB_USER_ID, props.CNB_GROUP_ID)))
+
+	return run, nil
+}
+
+// packageList appends the lists of packages, checking that every entry is a
+// package name rather than some other shell word.
+func packageList(lists ...[]string) ([]string, error) {
+	var packages []string
+	for _, list := range lists {
+		for _, pkg := range list {
+			if !packageName.MatchString(pkg) {
+				return nil, fmt.Errorf("invalid package name '%s'", pkg)
+			}
+			packages = append(packages, pkg)
+		}
+	}
+	return packages, nil
+}
+
+// symlinkCommands returns the commands creating the symlinks, checking that
+// both of their paths are absolute paths the shell leaves alone.
+func symlinkCommands(symlinks []structs.Symlink) ([]string, error) {
+	var commands []string
+	for _, symlink := range symlinks {
+		if err := validateSymlink(symlink); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case symlink.Remove:
+			commands = append(commands, fmt.Sprintf("rm %s && ln -s %s %s", symlink.Link, symlink.Target, symlink.Link))
+		case symlink.Force:
+			commands = append(commands, fmt.Sprintf("ln -sf %s %s", symlink.Target, symlink.Link))
+		default:
+			commands = append(commands, fmt.Sprintf("ln -s %s %s", symlink.Target, symlink.Link))
+		}
+	}
+	return commands, nil
+}
+
+func validateSymlink(symlink structs.Symlink) error {
+	for _, p := range []string{symlink.Link, symlink.Target} {
+		if !symlinkPath.MatchString(p) {
+			return fmt.Errorf("invalid symlink path '%s' in %s -> %s", p, symlink.Link, symlink.Target)
+		}
+	}
+	return nil
+}
+
+func fipsPackage(props structs.RunDockerfileProps) []string {
+	if props.FIPS {
+		return []string{"crypto-policies-scripts"}
+	}
+	return nil
+}
+
+// nssWrapperEnv makes nss_wrapper resolve the user IDs of OpenShift, which
+// the shells add to its passwd file, and sets the HOME they get in it for
+// every process, as nothing else runs before them.
+func nssWrapperEnv(home string) dockerfile.Env {
+	return dockerfile.Env{
+		{Key: "LD_PRELOAD", Value: "libnss_wrapper.so"},
+		{Key: "NSS_WRAPPER_PASSWD", Value: "/etc/nss_wrapper/passwd"},
+		{Key: "NSS_WRAPPER_GROUP", Value: "/etc/group"},
+		{Key: "BASH_ENV", Value: "/etc/nss_wrapper/nss_wrapper.sh"},
+		{Key: "HOME", Value: home},
+	}
+}
+
+func nssWrapperPackage(props structs.RunDockerfileProps) []string {
+	if props.OPENSHIFT {
+		return []string{props.NSS_WRAPPER_PACKAGE}
+	}
+	return nil
+}
+
+// moduleStream returns the nodejs module stream of the Node.js major version
+// when the module is enabled, or an empty stream otherwise.
+func moduleStream(enable bool, nodejsVersion uint64) (string, error) {
+	if !enable {
+		return "", nil
+	}
+	if nodejsVersion == 0 {
+		return "", fmt.Errorf("no Node.js version to enable the nodejs module stream of")
+	}
+	return fmt.Sprintf("nodejs:%d", nodejsVersion), nil
+}
+
+// installCommand installs the packages, after enabling the module stream
+// when it is set. keepcache keeps the repository metadata and the downloaded
+// packages in the package cache dir for the next build.
+func installCommand(pm structs.PackageManager, module string, gpgcheck, keepcache bool, packages []string) string {
+	var command strings.Builder
+	if pm.Detect != "" {
+		command.WriteString(pm.Detect + " && ")
+	}
+	if module != "" {
+		fmt.Fprintf(&command, "%s -y module enable %s && ", pm.Command, module)
+	}
+	command.WriteString(packageManagerCommand(pm, gpgcheck, keepcache))
+	command.WriteString(" \\\n    install -y " + strings.Join(packages, " "))
+	return command.String()
+}
+
+// packageManagerCommand is the package manager with the options every
+// transaction of the generated Dockerfiles uses.
+func packageManagerCommand(pm structs.PackageManager, gpgcheck, keepcache bool) string {
+	command := pm.Command + " " + pm.InstallOptions
+	if gpgcheck {
+		command += " --setopt=gpgcheck=1"
+	}
+	if keepcache {
+		command += " --setopt=cachedir=" + constants.PACKAGE_CACHE_DIR + " --setopt=keepcache=1"
+	}
+	return command
+}
+
+// cleanCommand removes the package metadata from the image. The package
+// cache dir is outside of the image and is left alone.
+func cleanCommand(pm structs.PackageManager) string {
+	return pm.Command + " clean all"
+}
+
+// reinstallTimezoneData reinstalls tzdata with the options of installCommand
+// when the zoneinfo files were left out of the image, as ubi-minimal does.
+func reinstallTimezoneData(pm structs.PackageManager, gpgcheck, keepcache bool) string {
+	return fmt.Sprintf("([ -e /usr/share/zoneinfo/UTC ] || %s \\\n    reinstall -y tzdata)", packageManagerCommand(pm, gpgcheck, keepcache))
+}
+
+func trustCACertificates(certificates []structs.File) []string {
+	commands := []string{"mkdir -p /etc/pki/ca-trust/source/anchors"}
+	for _, certificate := range certificates {
+		commands = append(commands, fmt.Sprintf("echo %s | base64 -d > /etc/pki/ca-trust/source/anchors/%s", certificate.Content, certificate.Name))
+	}
+	return append(commands, "update-ca-trust")
+}
+
+func addRepositories(repositories, gpgKeys []structs.File, disableDefault bool) []string {
+	commands := []string{"mkdir -p /etc/yum.repos.d /etc/pki/rpm-gpg"}
+	if disableDefault {
+		commands = append(commands,
+			"mkdir -p /etc/yum.repos.d.disabled",
+			`find /etc/yum.repos.d -maxdepth 1 -name '*.repo' -exec mv {} /etc/yum.repos.d.disabled/ \;`,
+		)
+	}
+	for _, key := range gpgKeys {
+		commands = append(commands,
+			fmt.Sprintf("echo %s | base64 -d > /etc/pki/rpm-gpg/%s", key.Content, key.Name),
+			fmt.Sprintf("rpm --import /etc/pki/rpm-gpg/%s", key.Name),
+		)
+	}
+	for _, repository := range repositories {
+		commands = append(commands, fmt.Sprintf("echo %s | base64 -d > /etc/yum.repos.d/%s", repository.Content, repository.Name))
+	}
+	return append(commands, "chmod 644 /etc/yum.repos.d/*.repo")
+}
+
+// removeRepositories removes the repositories from the run image once the
+// packages are installed, restoring the ones of the image.
+func removeRepositories(repositories []structs.File, disableDefault bool) []string {
+	remove := "rm -f"
+	for _, repository := range repositories {
+		remove += " /etc/yum.repos.d/" + repository.Name
+	}
+
+	commands := []string{remove}
+	if disableDefault {
+		commands = append(commands,
+			`find /etc/yum.repos.d.disabled -name '*.repo' -exec mv {} /etc/yum.repos.d/ \;`,
+			"rmdir /etc/yum.repos.d.disabled",
+		)
+	}
+	return commands
+}
+
+// provideSubscription copies the subscription files from the service
+// binding, which is only mounted while the Dockerfile is applied, keeping a
+// copy of /etc/rhsm for removeSubscription to restore, and adds the
+// repository that uses them.
+func provideSubscription(files []structs.BindingFile, repository structs.File) []string {
+	commands := []string{
+		"mkdir -p /etc/pki/entitlement /etc/rhsm/ca /etc/yum.repos.d",
+		"cp -a /etc/rhsm /tmp/rhsm",
+	}
+	for _, file := range files {
+		commands = append(commands, fmt.Sprintf("cp %s %s", file.Source, file.Dest))
+	}
+	return append(commands,
+		fmt.Sprintf("echo %s | base64 -d > /etc/yum.repos.d/%s", repository.Content, repository.Name),
+		"chmod 644 /etc/yum.repos.d/"+repository.Name,
+	)
+}
+
+func removeSubscription(repository structs.File) []string {
+	return []string{
+		"rm -rf /etc/pki/entitlement/* /etc/yum.repos.d/" + repository.Name + " /etc/rhsm",
+		"mv /tmp/rhsm /etc/rhsm",
+	}
+}
+
+// writeSBOM lists the packages installed since listInstalledPackages ran.
+func writeSBOM(sbom structs.SBOM) []string {
+	return []string{
+		fmt.Sprintf("echo %s | base64 -d > /tmp/sbom.js", sbom.Script),
+		fmt.Sprintf("node /tmp/sbom.js installed-since /tmp/rpms-before %s %s", sbom.Path, sbom.Metadata),
+		"rm /tmp/sbom.js /tmp/rpms-before",
+	}
+}
+
+func envVariables(variables []structs.EnvVar) dockerfile.Env {
+	env := make(dockerfile.Env, 0, len(variables))
+	for _, variable := range variables {
+		env = append(env, dockerfile.KeyValue{Key: variable.Name, Value: variable.Value})
+	}
+	return env
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	disabledGpgcheckOption  = regexp.MustCompile(`(?i)--nogpgchecks?\b|--no-gpgchecks?\b`)
+	disabledGpgcheckSetting = regexp.MustCompile(`(?i)\b((?:[\w.-]+\.)?(?:gpgcheck|localpkg_gpgcheck|pkg_gpgcheck))\s*=\s*["']?(0|false|no|off)\b`)
+	plainHTTPGpgkey         = regexp.MustCompile(`(?i)^\s*gpgkey\s*=.*\bhttp://`)
+)
+
+// CheckSignaturePolicy returns an error when the content, a generated
+// Dockerfile or a .repo file described by description, turns off the GPG
+// signature check of the installed packages, or fetches a GPG key over plain
+// HTTP.
+func CheckSignaturePolicy(description string, content string) error {
+	if match := disabledGpgcheckOption.FindString(content); match != "" {
+		return fmt.Errorf("%s turns off the GPG signature check with %s", description, match)
+	}
+
+	if match := disabledGpgcheckSetting.FindString(content); match != "" {
+		return fmt.Errorf("%s turns off the GPG signature check with %s", description, match)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if plainHTTPGpgkey.MatchString(scanner.Text()) {
+			return fmt.Errorf("%s fetches a GPG key over plain HTTP: %s", description, strings.TrimSpace(scanner.Text()))
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,58 @@
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testCheckSignaturePolicy(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should accept a repository file that checks the signatures", func() {
+		Expect(utils.CheckSignaturePolicy("custom.repo", `[custom]
+name=Custom
+baseurl=https://example.com/rpms
+gpgcheck=1
+repo_gpgcheck=1
+gpgkey=https://example.com/RPM-GPG-KEY-custom
+`)).To(Succeed())
+	})
+
+	it("should accept a Dockerfile that installs with the signature check", func() {
+		Expect(utils.CheckSignaturePolicy("the generated build.Dockerfile", "RUN microdnf -y install --setopt=gpgcheck=1 nodejs")).To(Succeed())
+	})
+
+	context("Failure cases", func() {
+
+		it("should error for the --nogpgcheck option", func() {
+			err := utils.CheckSignaturePolicy("the generated run.Dockerfile", "RUN microdnf -y install --nogpgcheck nodejs")
+			Expect(err).To(MatchError("the generated run.Dockerfile turns off the GPG signature check with --nogpgcheck"))
+		})
+
+		it("should error for a repository with gpgcheck=0", func() {
+			err := utils.CheckSignaturePolicy("custom.repo", "[custom]\nbaseurl=https://example.com/rpms\ngpgcheck=0\n")
+			Expect(err).To(MatchError("custom.repo turns off the GPG signature check with gpgcheck=0"))
+		})
+
+		it("should error for a setopt turning off the check of a repository", func() {
+			err := utils.CheckSignaturePolicy("the generated build.Dockerfile", "RUN dnf install --setopt=custom.gpgcheck=False nodejs")
+			Expect(err).To(MatchError("the generated build.Dockerfile turns off the GPG signature check with custom.gpgcheck=False"))
+		})
+
+		it("should error for localpkg_gpgcheck=0", func() {
+			err := utils.CheckSignaturePolicy("dnf.conf", "[main]\nlocalpkg_gpgcheck = 0\n")
+			Expect(err).To(MatchError("dnf.conf turns off the GPG signature check with localpkg_gpgcheck = 0"))
+		})
+
+		it("should error for a GPG key fetched over plain HTTP", func() {
+			err := utils.CheckSignaturePolicy("custom.repo", "[custom]\ngpgcheck=1\ngpgkey=http://example.com/RPM-GPG-KEY-custom\n")
+			Expect(err).To(MatchError("custom.repo fetches a GPG key over plain HTTP: gpgkey=http://example.com/RPM-GPG-KEY-custom"))
+		})
+	})
+}
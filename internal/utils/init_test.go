@@ -18,6 +18,23 @@ func TestUnitUtils(t *testing.T) {
 	suite("testGenerateBuildDockerfile", testGenerateBuildDockerfile)
 	suite("testGenerateRunDockerfile", testGenerateRunDockerfile)
 	suite("testGetBuildPackages", testGetBuildPackages)
+	suite("testGetRunPackages", testGetRunPackages)
+	suite("GetPackageManager", testGetPackageManager)
+	suite("DistroProfiles", testDistroProfiles)
+	suite("GetCACertificates", testGetCACertificates)
+	suite("GetRepositories", testGetRepositories)
+	suite("BuildArgs", testBuildArgs)
+	suite("GetRHSMFiles", testGetRHSMFiles)
+	suite("GetProvenanceLabels", testGetProvenanceLabels)
+	suite("GetSBOM", testGetSBOM)
+	suite("FindVulnerabilities", testFindVulnerabilities)
+	suite("GetVulnerabilityFeeds", testGetVulnerabilityFeeds)
+	suite("CheckSignaturePolicy", testCheckSignaturePolicy)
+	suite("GetRunConfig", testGetRunConfig)
+	suite("GetLocalePackages", testGetLocalePackages)
 	suite("testGetOsCodenameFromStackId", testGetOsCodenameFromStackId)
+	suite("ParseImageReference", testParseImageReference)
+	suite("VerifyRunImageSignature", testVerifyRunImageSignature)
+	suite("CheckRunImageNodeVersion", testCheckRunImageNodeVersion)
 	suite.Run(t)
 }
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// Provenance records what the extension selected for an image. Empty fields
+// are left out of the labels.
+type Provenance struct {
+	ExtensionID      string
+	ExtensionVersion string
+	NodeMajorVersion uint64
+
+	// NodeVersion is the exact Node.js version, which is only known when it
+	// was read from the run image.
+	NodeVersion   string
+	VersionSource string
+
+	// NodePackage is the name-epoch:version-release.arch of the Node.js
+	// package, when the run image declares it as well.
+	NodePackage string
+
+	StackId      string
+	Target       string
+	TargetDistro string
+
+	RunImage       string
+	RunImageDigest string
+}
+
+// GetProvenanceLabels returns the labels of the provenance, all in the
+// io.paketo.ubi-nodejs namespace.
+func GetProvenanceLabels(provenance Provenance) []structs.Label {
+	var labels []structs.Label
+	add := func(name string, value string) {
+		if value != "" {
+			labels = append(labels, structs.Label{Name: fmt.Sprintf("%s.%s", constants.LABEL_NAMESPACE, name), Value: value})
+		}
+	}
+
+	add("extension.id", provenance.ExtensionID)
+	add("extension.version", provenance.ExtensionVersion)
+	add("node.major-version", fmt.Sprintf("%d", provenance.NodeMajorVersion))
+	add("node.version", provenance.NodeVersion)
+	add("node.version-source", provenance.VersionSource)
+	add("node.package", provenance.NodePackage)
+	add("stack", provenance.StackId)
+	add("target", provenance.Target)
+	add("target.distro", provenance.TargetDistro)
+	add("run-image", provenance.RunImage)
+	add("run-image.digest", provenance.RunImageDigest)
+
+	return labels
+}
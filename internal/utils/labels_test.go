@@ -0,0 +1,61 @@
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetProvenanceLabels(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should return a label for each field of the provenance", func() {
+		labels := utils.GetProvenanceLabels(utils.Provenance{
+			ExtensionID:      "paketo-community/ubi-nodejs-extension",
+			ExtensionVersion: "1.2.3",
+			NodeMajorVersion: 20,
+			NodeVersion:      "20.11.1",
+			VersionSource:    "BP_NODE_VERSION",
+			NodePackage:      "nodejs-1:20.11.1-1.module+el9.3.0.aarch64",
+			StackId:          "io.buildpacks.stacks.ubi9",
+			Target:           "linux/arm64",
+			TargetDistro:     "rhel 9",
+			RunImage:         "paketobuildpacks/run-nodejs-20-ubi9-base",
+			RunImageDigest:   "sha256:1234",
+		})
+
+		Expect(labels).To(Equal([]structs.Label{
+			{Name: "io.paketo.ubi-nodejs.extension.id", Value: "paketo-community/ubi-nodejs-extension"},
+			{Name: "io.paketo.ubi-nodejs.extension.version", Value: "1.2.3"},
+			{Name: "io.paketo.ubi-nodejs.node.major-version", Value: "20"},
+			{Name: "io.paketo.ubi-nodejs.node.version", Value: "20.11.1"},
+			{Name: "io.paketo.ubi-nodejs.node.version-source", Value: "BP_NODE_VERSION"},
+			{Name: "io.paketo.ubi-nodejs.node.package", Value: "nodejs-1:20.11.1-1.module+el9.3.0.aarch64"},
+			{Name: "io.paketo.ubi-nodejs.stack", Value: "io.buildpacks.stacks.ubi9"},
+			{Name: "io.paketo.ubi-nodejs.target", Value: "linux/arm64"},
+			{Name: "io.paketo.ubi-nodejs.target.distro", Value: "rhel 9"},
+			{Name: "io.paketo.ubi-nodejs.run-image", Value: "paketobuildpacks/run-nodejs-20-ubi9-base"},
+			{Name: "io.paketo.ubi-nodejs.run-image.digest", Value: "sha256:1234"},
+		}))
+	})
+
+	it("should leave out the fields that are not set", func() {
+		labels := utils.GetProvenanceLabels(utils.Provenance{
+			NodeMajorVersion: 22,
+			VersionSource:    "default",
+			StackId:          "io.buildpacks.stacks.ubi8",
+		})
+
+		Expect(labels).To(Equal([]structs.Label{
+			{Name: "io.paketo.ubi-nodejs.node.major-version", Value: "22"},
+			{Name: "io.paketo.ubi-nodejs.node.version-source", Value: "default"},
+			{Name: "io.paketo.ubi-nodejs.stack", Value: "io.buildpacks.stacks.ubi8"},
+		}))
+	})
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+var (
+	localeName   = regexp.MustCompile(`^([a-z]{2,3})(_[A-Z]{2})?(\.(UTF-8|utf8))?(@[a-z]+)?$`)
+	timezoneName = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+)
+
+// GetLocalePackages returns the glibc langpacks of the comma or space
+// separated locales and the tzdata package of the time zone data setting,
+// together with the LANG and TZ variables they are used with. LANG is the
+// first locale, which needs a territory, with UTF-8 as the default codeset.
+// The time zone data setting is either "true" or the time zone to set as
+// TZ. The C locale needs no langpack.
+func GetLocalePackages(locales string, timezoneData string) ([]string, []structs.EnvVar, error) {
+	var (
+		packages []string
+		env      []structs.EnvVar
+	)
+
+	for index, locale := range strings.FieldsFunc(locales, func(r rune) bool { return r == ',' || r == ' ' }) {
+		lang := locale
+		if locale == "C" || strings.HasPrefix(locale, "C.") {
+			lang = "C.UTF-8"
+		} else {
+			matches := localeName.FindStringSubmatch(locale)
+			if matches == nil {
+				return nil, nil, fmt.Errorf("invalid locale '%s', expected a language and optionally a territory, e.g. en or en_US", locale)
+			}
+
+			if langpack := "glibc-langpack-" + matches[1]; !slices.Contains(packages, langpack) {
+				packages = append(packages, langpack)
+			}
+
+			if matches[2] == "" {
+				lang = ""
+			} else if matches[3] == "" {
+				lang = matches[1] + matches[2] + ".UTF-8" + matches[5]
+			}
+		}
+
+		if index == 0 {
+			if lang == "" {
+				return nil, nil, fmt.Errorf("the first locale '%s' is set as LANG and needs a territory, e.g. en_US", locale)
+			}
+			env = append(env, structs.EnvVar{Name: "LANG", Value: lang})
+		}
+	}
+
+	switch timezoneData {
+	case "", "false":
+	case "true":
+		packages = append(packages, "tzdata")
+	default:
+		if !timezoneName.MatchString(timezoneData) {
+			return nil, nil, fmt.Errorf("invalid time zone '%s', expected 'true' or a time zone, e.g. Europe/Berlin", timezoneData)
+		}
+		packages = append(packages, "tzdata")
+		env = append(env, structs.EnvVar{Name: "TZ", Value: timezoneData})
+	}
+
+	return packages, env, nil
+}
@@ -0,0 +1,69 @@
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetLocalePackages(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should return nothing without settings", func() {
+		packages, env, err := utils.GetLocalePackages("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(BeEmpty())
+		Expect(env).To(BeEmpty())
+	})
+
+	it("should return a langpack per language and set LANG to the first locale", func() {
+		packages, env, err := utils.GetLocalePackages("de_DE, de_AT,fr en_GB.UTF-8", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(Equal([]string{"glibc-langpack-de", "glibc-langpack-fr", "glibc-langpack-en"}))
+		Expect(env).To(Equal([]structs.EnvVar{{Name: "LANG", Value: "de_DE.UTF-8"}}))
+	})
+
+	it("should keep the codeset and modifier of the first locale", func() {
+		_, env, err := utils.GetLocalePackages("sr_RS.utf8@latin", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal([]structs.EnvVar{{Name: "LANG", Value: "sr_RS.utf8@latin"}}))
+	})
+
+	it("should not need a langpack for the C locale", func() {
+		packages, env, err := utils.GetLocalePackages("C.UTF-8", "true")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(Equal([]string{"tzdata"}))
+		Expect(env).To(Equal([]structs.EnvVar{{Name: "LANG", Value: "C.UTF-8"}}))
+	})
+
+	it("should set TZ to the time zone", func() {
+		packages, env, err := utils.GetLocalePackages("", "America/Argentina/Buenos_Aires")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(Equal([]string{"tzdata"}))
+		Expect(env).To(Equal([]structs.EnvVar{{Name: "TZ", Value: "America/Argentina/Buenos_Aires"}}))
+	})
+
+	context("Failure cases", func() {
+
+		it("should error for an invalid locale", func() {
+			_, _, err := utils.GetLocalePackages("english", "")
+			Expect(err).To(MatchError("invalid locale 'english', expected a language and optionally a territory, e.g. en or en_US"))
+		})
+
+		it("should error for a first locale without a territory", func() {
+			_, _, err := utils.GetLocalePackages("de,en_US", "")
+			Expect(err).To(MatchError("the first locale 'de' is set as LANG and needs a territory, e.g. en_US"))
+		})
+
+		it("should error for an invalid time zone", func() {
+			_, _, err := utils.GetLocalePackages("", "../etc/passwd")
+			Expect(err).To(MatchError("invalid time zone '../etc/passwd', expected 'true' or a time zone, e.g. Europe/Berlin"))
+		})
+	})
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+)
+
+//go:embed templates/nss_wrapper.sh
+var nssWrapperScript []byte
+
+// GetNssWrapperScript returns the base64 encoded script that adds arbitrary
+// user IDs to the passwd file of nss_wrapper in the run image, with home as
+// their home directory.
+func GetNssWrapperScript(home string) string {
+	return base64.StdEncoding.EncodeToString(bytes.ReplaceAll(nssWrapperScript, []byte("@HOME@"), []byte(home)))
+}
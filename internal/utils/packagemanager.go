@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+var packageManagers = map[string]structs.PackageManager{
+	"microdnf": {
+		Name:           "microdnf",
+		Command:        "microdnf",
+		InstallOptions: "--setopt=install_weak_deps=0 --setopt=tsflags=nodocs",
+	},
+	"dnf": {
+		Name:           "dnf",
+		Command:        "dnf",
+		InstallOptions: "--setopt=install_weak_deps=False --setopt=tsflags=nodocs",
+	},
+	"yum": {
+		Name:           "yum",
+		Command:        "yum",
+		InstallOptions: "--setopt=install_weak_deps=False --setopt=tsflags=nodocs",
+	},
+	// auto picks the first package manager found in the image while it is
+	// built. The install options are the ones understood by all of them.
+	"auto": {
+		Name:           "auto",
+		Command:        "${package_manager}",
+		Detect:         "package_manager=$(command -v microdnf || command -v dnf || command -v yum)",
+		InstallOptions: "--setopt=install_weak_deps=0 --setopt=tsflags=nodocs",
+	},
+}
+
+// GetPackageManager returns the package manager with the given name, or
+// microdnf, which all the supported builders are based on, when name is empty.
+func GetPackageManager(name string) (structs.PackageManager, error) {
+	if name == "" {
+		name = "microdnf"
+	}
+
+	packageManager, ok := packageManagers[name]
+	if !ok {
+		return structs.PackageManager{}, fmt.Errorf("unsupported package manager '%s', expected 'microdnf', 'dnf', 'yum' or 'auto'", name)
+	}
+
+	return packageManager, nil
+}
+
+func withDefaultPackageManager(packageManager structs.PackageManager) structs.PackageManager {
+	if packageManager.Command == "" {
+		return packageManagers["microdnf"]
+	}
+	return packageManager
+}
@@ -0,0 +1,114 @@
+package utils_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+// Run the tests with UPDATE_GOLDEN=true to regenerate the golden files after
+// an intended change of the Dockerfile templates.
+func testGetPackageManager(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should default to microdnf", func() {
+		packageManager, err := utils.GetPackageManager("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packageManager.Name).To(Equal("microdnf"))
+		Expect(packageManager.Command).To(Equal("microdnf"))
+	})
+
+	it("should error for an unsupported package manager", func() {
+		_, err := utils.GetPackageManager("apt")
+		Expect(err).To(MatchError("unsupported package manager 'apt', expected 'microdnf', 'dnf', 'yum' or 'auto'"))
+	})
+
+	context("generating the Dockerfiles", func() {
+		testCases := []struct {
+			stackId     string
+			nodeVersion int
+		}{
+			{stackId: "io.buildpacks.stacks.ubi8", nodeVersion: 22},
+			{stackId: "io.buildpacks.stacks.ubi9", nodeVersion: 20},
+			{stackId: "io.buildpacks.stacks.ubi10", nodeVersion: 24},
+		}
+
+		for _, tt := range testCases {
+			for _, packageManagerName := range []string{"microdnf", "dnf", "yum", "auto"} {
+				stackId, nodeVersion, packageManagerName := tt.stackId, tt.nodeVersion, packageManagerName
+				osCodename := strings.TrimPrefix(stackId, "io.buildpacks.stacks.")
+				goldenFilePrefix := filepath.Join("testdata", "golden", fmt.Sprintf("%s-%d-%s", osCodename, nodeVersion, packageManagerName))
+
+				it(fmt.Sprintf("should match the golden files for %s, Node.js %d and %s", osCodename, nodeVersion, packageManagerName), func() {
+					packageManager, err := utils.GetPackageManager(packageManagerName)
+					Expect(err).NotTo(HaveOccurred())
+
+					// The props are the ones Generate sets, with BP_UBI_SBOM
+					nodeProfile, err := utils.GetNodeProfile(stackId, "amd64", nodeVersion)
+					Expect(err).NotTo(HaveOccurred())
+
+					distroProfile, err := utils.GetDistroProfile(stackId)
+					Expect(err).NotTo(HaveOccurred())
+
+					sbom, err := utils.GetSBOM([]packit.BOMEntry{{Name: "node"}}, distroProfile.Distro.Name)
+					Expect(err).NotTo(HaveOccurred())
+
+					buildDockerfile, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+						NODEJS_VERSION:       uint64(nodeVersion),
+						CNB_USER_ID:          1002,
+						CNB_GROUP_ID:         1000,
+						PACKAGES:             nodeProfile.GetBuildPackages(),
+						SYMLINKS:             nodeProfile.GetSymlinks(),
+						ENABLE_NODEJS_MODULE: distroProfile.EnableNodejsModule,
+						PACKAGE_MANAGER:      packageManager,
+						SBOM:                 sbom,
+						VERIFY:               true,
+						VERIFY_NPM:           nodeProfile.ProvidesNpm(),
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					runDockerfile, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+						EXTEND:               true,
+						NODEJS_VERSION:       uint64(nodeVersion),
+						CNB_USER_ID:          1002,
+						CNB_GROUP_ID:         1000,
+						PACKAGES:             nodeProfile.GetRunPackages(),
+						SYMLINKS:             nodeProfile.GetRunSymlinks(),
+						ENABLE_NODEJS_MODULE: distroProfile.EnableNodejsModule,
+						PACKAGE_MANAGER:      packageManager,
+						SBOM:                 sbom,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					expectGoldenFile(t, goldenFilePrefix+".build.Dockerfile", buildDockerfile)
+					expectGoldenFile(t, goldenFilePrefix+".run.Dockerfile", runDockerfile)
+				})
+			}
+		}
+	})
+}
+
+func expectGoldenFile(t *testing.T, path string, content string) {
+	t.Helper()
+	Expect := NewWithT(t).Expect
+
+	if os.Getenv("UPDATE_GOLDEN") == "true" {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(content).To(Equal(string(expected)), "generated content does not match %s", path)
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// passwdEntry is the part of an /etc/passwd or /etc/group entry needed to
+// resolve the CNB user, with the group ID as id for /etc/group.
+type passwdEntry struct {
+	name   string
+	id     int
+	group  int
+	home   string
+	source string
+}
+
+// GetDuringBuildPermissions returns the user and group the images are built
+// with, and the home of the user, together with a description of where they
+// were taken from.
+// CNB_USER_ID and CNB_GROUP_ID take precedence over the user named by
+// BP_UBI_CNB_USER, cnb by default, in the passwd file. BP_UBI_CNB_GROUP
+// names a group of the group file to use instead of the primary group of the
+// user. It errors when the user or the group can not be determined.
+func GetDuringBuildPermissions(passwdPath string, groupPath string, lookupEnv func(string) (string, bool)) (structs.DuringBuildPermissions, string, error) {
+	userID, hasUserID, err := lookupID("CNB_USER_ID", lookupEnv)
+	if err != nil {
+		return structs.DuringBuildPermissions{}, "", err
+	}
+	groupID, hasGroupID, err := lookupID("CNB_GROUP_ID", lookupEnv)
+	if err != nil {
+		return structs.DuringBuildPermissions{}, "", err
+	}
+
+	userSource, groupSource := "CNB_USER_ID", "CNB_GROUP_ID"
+	groupName, _ := lookupEnv("BP_UBI_CNB_GROUP")
+
+	if !hasGroupID && groupName != "" {
+		group, err := findPasswdEntry(groupPath, "group", func(entry passwdEntry) bool { return entry.name == groupName })
+		if err != nil {
+			return structs.DuringBuildPermissions{}, "", err
+		}
+		if group == nil {
+			return structs.DuringBuildPermissions{}, "", fmt.Errorf("group '%s' of BP_UBI_CNB_GROUP not found in %s", groupName, groupPath)
+		}
+		groupID, hasGroupID, groupSource = group.id, true, group.source
+	}
+
+	if !hasUserID || !hasGroupID {
+		userName, _ := lookupEnv("BP_UBI_CNB_USER")
+		if userName == "" {
+			userName = "cnb"
+		}
+
+		// With CNB_USER_ID only the primary group of that user is missing.
+		matches := func(entry passwdEntry) bool { return entry.name == userName }
+		if hasUserID {
+			matches = func(entry passwdEntry) bool { return entry.id == userID }
+		}
+
+		user, err := findPasswdEntry(passwdPath, "user", matches)
+		if err != nil {
+			return structs.DuringBuildPermissions{}, "", err
+		}
+		if user == nil {
+			if hasUserID {
+				return structs.DuringBuildPermissions{}, "", fmt.Errorf("no user with the ID %d of CNB_USER_ID found in %s to take the group from, set CNB_GROUP_ID or BP_UBI_CNB_GROUP", userID, passwdPath)
+			}
+			return structs.DuringBuildPermissions{}, "", fmt.Errorf("user '%s' not found in %s, set CNB_USER_ID and CNB_GROUP_ID or BP_UBI_CNB_USER", userName, passwdPath)
+		}
+
+		if !hasUserID {
+			userID, userSource = user.id, user.source
+		}
+		if !hasGroupID {
+			groupID, groupSource = user.group, user.source
+		}
+	}
+
+	source := userSource
+	if groupSource != userSource {
+		source = fmt.Sprintf("%s and %s", userSource, groupSource)
+	}
+
+	// The IDs don't depend on the passwd file when they are both set, so
+	// the home is only taken from it when it can be read.
+	var home string
+	if user, err := findPasswdEntry(passwdPath, "user", func(entry passwdEntry) bool { return entry.id == userID }); err == nil && user != nil {
+		home = user.home
+	}
+
+	return structs.DuringBuildPermissions{CNB_USER_ID: userID, CNB_GROUP_ID: groupID, CNB_USER_HOME: home}, source, nil
+}
+
+func lookupID(name string, lookupEnv func(string) (string, bool)) (int, bool, error) {
+	value, ok := lookupEnv(name)
+	if !ok || value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("invalid %s value '%s', expected a numeric ID", name, value)
+	}
+	return id, true, nil
+}
+
+// findPasswdEntry returns the first entry of a passwd file, or of a group
+// file when kind is "group", that matches, or nil when there is none.
+// Comments and empty lines are skipped.
+func findPasswdEntry(path string, kind string, matches func(passwdEntry) bool) (*passwdEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Both name:password:ID:group:... and name:password:ID:members
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("malformed entry on line %d of %s", lineNumber, path)
+		}
+
+		entry := passwdEntry{name: fields[0], source: fmt.Sprintf("%s '%s' in %s", kind, fields[0], path)}
+		if entry.id, err = strconv.Atoi(fields[2]); err != nil {
+			return nil, fmt.Errorf("malformed ID '%s' on line %d of %s", fields[2], lineNumber, path)
+		}
+		if kind == "user" {
+			if entry.group, err = strconv.Atoi(fields[3]); err != nil {
+				return nil, fmt.Errorf("malformed group ID '%s' on line %d of %s", fields[3], lineNumber, path)
+			}
+			if len(fields) > 5 {
+				entry.home = fields[5]
+			}
+		}
+
+		if matches(entry) {
+			return &entry, nil
+		}
+	}
+
+	return nil, scanner.Err()
+}
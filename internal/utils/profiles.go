@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+//go:embed profiles/*.toml
+var distroProfileFiles embed.FS
+
+// DistroProfile describes how Node.js is installed on an RPM based distro.
+// Profiles are read from the profiles directory, so supporting another
+// distro built the same way as the UBI images only needs a new file there.
+type DistroProfile struct {
+	Name   string   `toml:"name"`
+	Stacks []string `toml:"stacks"`
+	Distro struct {
+		Name    string `toml:"name"`
+		Version string `toml:"version"`
+	} `toml:"distro"`
+	PackageManager     string `toml:"package_manager"`
+	EnableNodejsModule bool   `toml:"enable_nodejs_module"`
+
+	// RunImage is a template for the run image of a Node.js major version,
+	// with NodeVersion and OsCodename as fields. It is empty for the distros
+	// without published Node.js run images, whose run image is extended with
+	// Node.js instead.
+	RunImage string `toml:"run_image"`
+
+	// EntitledRepositories are the RHEL repositories an entitlement of the
+	// rhsm service binding gives access to. The distros without them can not
+	// use a subscription.
+	EntitledRepositories []EntitledRepository `toml:"entitled_repositories"`
+
+	Node []NodeProfile `toml:"node"`
+}
+
+// EntitledRepository is written to the redhat.repo of the image while the
+// packages are installed with a subscription. The BaseURL may contain
+// $basearch, which the package manager replaces.
+type EntitledRepository struct {
+	ID      string `toml:"id"`
+	Name    string `toml:"name"`
+	BaseURL string `toml:"baseurl"`
+	GPGKey  string `toml:"gpgkey"`
+}
+
+type NodeProfile struct {
+	Versions []int `toml:"versions"`
+
+	// Architectures limits the versions to the listed architectures, they
+	// are available on all of them when empty.
+	Architectures []string `toml:"architectures"`
+
+	BuildPackages []string  `toml:"build_packages"`
+	RunPackages   []string  `toml:"run_packages"`
+	Symlinks      []Symlink `toml:"symlinks"`
+
+	// FullICUPackages provide the full ICU data of the Node.js runtime, for
+	// the builds that only come with small-icu or a subset of the locales.
+	FullICUPackages []string `toml:"full_icu_packages"`
+
+	// Fips is set when Node.js uses the system OpenSSL, which can be
+	// switched to FIPS mode.
+	Fips bool `toml:"fips"`
+
+	// Arch replaces the packages or symlinks above on the architectures
+	// where they differ, keyed by the Go architecture name (e.g. s390x).
+	Arch map[string]NodeArchProfile `toml:"arch"`
+}
+
+type NodeArchProfile struct {
+	BuildPackages []string  `toml:"build_packages"`
+	RunPackages   []string  `toml:"run_packages"`
+	Symlinks      []Symlink `toml:"symlinks"`
+}
+
+// Symlink is created after the packages are installed. Remove deletes an
+// existing link first, Force replaces it with ln -sf, and BuildOnly links
+// are left out of the run image.
+type Symlink struct {
+	Link      string `toml:"link"`
+	Target    string `toml:"target"`
+	Remove    bool   `toml:"remove"`
+	Force     bool   `toml:"force"`
+	BuildOnly bool   `toml:"build_only"`
+}
+
+var distroProfiles = mustLoadDistroProfiles()
+
+func mustLoadDistroProfiles() []DistroProfile {
+	profiles, err := loadDistroProfiles()
+	if err != nil {
+		panic(err)
+	}
+	return profiles
+}
+
+func loadDistroProfiles() ([]DistroProfile, error) {
+	entries, err := distroProfileFiles.ReadDir("profiles")
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []DistroProfile
+	for _, entry := range entries {
+		var profile DistroProfile
+		if _, err := toml.DecodeFS(distroProfileFiles, path.Join("profiles", entry.Name()), &profile); err != nil {
+			return nil, fmt.Errorf("failed to parse distro profile %s: %w", entry.Name(), err)
+		}
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("invalid distro profile %s: %w", entry.Name(), err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// GetDistroProfile returns the profile matching the stack ID.
+func GetDistroProfile(stackId string) (DistroProfile, error) {
+	for _, profile := range distroProfiles {
+		if slices.Contains(profile.Stacks, stackId) {
+			return profile, nil
+		}
+	}
+
+	return DistroProfile{}, fmt.Errorf("unsupported image ID: %s", stackId)
+}
+
+// GetStackIdFromTargetDistro returns the stack ID of the profile matching the
+// target distro, for platforms that no longer provide a stack ID. The distro
+// version matches when it is the profile version or one of its minor
+// releases.
+func GetStackIdFromTargetDistro(name string, version string) (string, error) {
+	for _, profile := range distroProfiles {
+		if profile.Distro.Name != name {
+			continue
+		}
+
+		if version == profile.Distro.Version || strings.HasPrefix(version, profile.Distro.Version+".") {
+			return profile.Stacks[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported target distro: %s %s", name, version)
+}
+
+// GetNodeProfile returns the packages and symlinks of the Node.js major
+// version on the image and architecture.
+func GetNodeProfile(imageId string, arch string, nodeVersion int) (NodeProfile, error) {
+	profile, err := GetDistroProfile(imageId)
+	if err != nil {
+		return NodeProfile{}, err
+	}
+
+	for _, node := range profile.Node {
+		if slices.Contains(node.Versions, nodeVersion) {
+			return node.ForArch(arch, fmt.Sprintf("Node.js version %d for image %s", nodeVersion, imageId))
+		}
+	}
+
+	return NodeProfile{}, fmt.Errorf("unsupported Node.js version %d for image %s", nodeVersion, imageId)
+}
+
+// ForArch returns the node profile with the overrides of the architecture
+// applied. The description is used in the error when it is not available.
+func (n NodeProfile) ForArch(arch string, description string) (NodeProfile, error) {
+	if len(n.Architectures) > 0 && !slices.Contains(n.Architectures, arch) {
+		return NodeProfile{}, fmt.Errorf("unsupported architecture %s for %s", arch, description)
+	}
+
+	override, ok := n.Arch[arch]
+	if !ok {
+		return n, nil
+	}
+
+	if override.BuildPackages != nil {
+		n.BuildPackages = override.BuildPackages
+	}
+	if override.RunPackages != nil {
+		n.RunPackages = override.RunPackages
+	}
+	if override.Symlinks != nil {
+		n.Symlinks = override.Symlinks
+	}
+
+	return n, nil
+}
+
+func (n NodeProfile) GetBuildPackages() []string {
+	return slices.Clone(n.BuildPackages)
+}
+
+func (n NodeProfile) GetRunPackages() []string {
+	return slices.Clone(n.RunPackages)
+}
+
+func (n NodeProfile) GetFullICUPackages() []string {
+	return slices.Clone(n.FullICUPackages)
+}
+
+func (n NodeProfile) GetSymlinks() []structs.Symlink {
+	return symlinks(n.Symlinks, true)
+}
+
+// GetRunSymlinks leaves out the symlinks that are only needed at build time.
+func (n NodeProfile) GetRunSymlinks() []structs.Symlink {
+	return symlinks(n.Symlinks, false)
+}
+
+// GetNssWrapperPackage returns the build package providing the nss_wrapper
+// library, or an empty string when there is none.
+func (n NodeProfile) GetNssWrapperPackage() string {
+	for _, pkg := range n.BuildPackages {
+		if strings.HasPrefix(pkg, "nss_wrapper") {
+			return pkg
+		}
+	}
+	return ""
+}
+
+// ProvidesNpm reports whether npm is installed with the build packages,
+// either as its own package or as the npm subpackage of a Node.js stream.
+func (n NodeProfile) ProvidesNpm() bool {
+	for _, pkg := range n.BuildPackages {
+		if pkg == "npm" || strings.HasSuffix(pkg, "-npm") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRunImage returns the run image name of a Node.js major version, or an
+// empty name when the distro has no Node.js run images.
+func (p DistroProfile) GetRunImage(nodeVersion string, osCodename string) (string, error) {
+	if p.RunImage == "" {
+		return "", nil
+	}
+
+	templ, err := template.New("run_image").Parse(p.RunImage)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse run image of distro profile %s: %w", p.Name, err)
+	}
+
+	var buf bytes.Buffer
+	err = templ.Execute(&buf, struct{ NodeVersion, OsCodename string }{nodeVersion, osCodename})
+	if err != nil {
+		return "", fmt.Errorf("failed to render run image of distro profile %s: %w", p.Name, err)
+	}
+
+	return buf.String(), nil
+}
+
+func symlinks(profileSymlinks []Symlink, includeBuildOnly bool) []structs.Symlink {
+	var symlinks []structs.Symlink
+	for _, symlink := range profileSymlinks {
+		if symlink.BuildOnly && !includeBuildOnly {
+			continue
+		}
+		symlinks = append(symlinks, symlink.toStruct())
+	}
+	return symlinks
+}
+
+func (s Symlink) toStruct() structs.Symlink {
+	return structs.Symlink{Link: s.Link, Target: s.Target, Remove: s.Remove, Force: s.Force}
+}
+
+// validate checks the package names and symlink paths of the profile when
+// it is loaded, as they end up in the RUN instructions of the Dockerfiles.
+func (p DistroProfile) validate() error {
+	for _, repository := range p.EntitledRepositories {
+		if !repositoryID.MatchString(repository.ID) || strings.ContainsAny(repository.Name+repository.BaseURL+repository.GPGKey, "\n\r") ||
+			!strings.HasPrefix(repository.BaseURL, "https://") || !strings.HasPrefix(repository.GPGKey, "file:///") {
+			return fmt.Errorf("invalid entitled repository '%s', expected an ID, an https:// baseurl and a file:/// gpgkey", repository.ID)
+		}
+	}
+
+	for _, node := range p.Node {
+		if _, err := packageList(node.FullICUPackages); err != nil {
+			return err
+		}
+
+		profiles := []NodeArchProfile{{BuildPackages: node.BuildPackages, RunPackages: node.RunPackages, Symlinks: node.Symlinks}}
+		for _, override := range node.Arch {
+			profiles = append(profiles, override)
+		}
+		for _, profile := range profiles {
+			if _, err := packageList(profile.BuildPackages, profile.RunPackages); err != nil {
+				return err
+			}
+			for _, symlink := range profile.Symlinks {
+				if err := validateSymlink(symlink.toStruct()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package utils_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testDistroProfiles(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+
+		// profiles returns the profiles of the files, as GetDistroProfile
+		// returns them for the first stack of each file.
+		profiles = func() []utils.DistroProfile {
+			files, err := filepath.Glob(filepath.Join("profiles", "*.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).NotTo(BeEmpty())
+
+			var profiles []utils.DistroProfile
+			for _, file := range files {
+				var profile utils.DistroProfile
+				_, err := toml.DecodeFile(file, &profile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(profile.Stacks).NotTo(BeEmpty(), "profile %s has no stacks", file)
+
+				profile, err = utils.GetDistroProfile(profile.Stacks[0])
+				Expect(err).NotTo(HaveOccurred())
+				profiles = append(profiles, profile)
+			}
+			return profiles
+		}
+	)
+
+	it("should load complete profiles", func() {
+		for _, profile := range profiles() {
+			Expect(profile.Distro.Name).NotTo(BeEmpty(), "profile %s has no distro", profile.Name)
+
+			_, err := utils.GetPackageManager(profile.PackageManager)
+			Expect(err).NotTo(HaveOccurred(), "profile %s", profile.Name)
+
+			Expect(profile.Node).NotTo(BeEmpty(), "profile %s has no Node.js versions", profile.Name)
+			for _, node := range profile.Node {
+				Expect(node.BuildPackages).NotTo(BeEmpty(), "profile %s", profile.Name)
+				Expect(node.RunPackages).NotTo(BeEmpty(), "profile %s", profile.Name)
+				Expect(node.FullICUPackages).NotTo(BeEmpty(), "profile %s", profile.Name)
+				Expect(node.ProvidesNpm()).To(BeTrue(), "profile %s", profile.Name)
+
+				for arch := range node.Arch {
+					Expect([]string{"amd64", "arm64", "s390x", "ppc64le"}).To(ContainElement(arch), "profile %s", profile.Name)
+				}
+
+				for _, arch := range []string{"amd64", "arm64", "s390x", "ppc64le"} {
+					if len(node.Architectures) > 0 && !slices.Contains(node.Architectures, arch) {
+						continue
+					}
+					for _, nodeVersion := range node.Versions {
+						nodeProfile, err := utils.GetNodeProfile(profile.Stacks[0], arch, nodeVersion)
+						Expect(err).NotTo(HaveOccurred(), "profile %s on %s", profile.Name, arch)
+						Expect(nodeProfile.GetNssWrapperPackage()).NotTo(BeEmpty(), "profile %s on %s", profile.Name, arch)
+					}
+				}
+			}
+		}
+	})
+
+	it("should match every stack ID to a single profile", func() {
+		stacks := map[string]string{}
+		for _, profile := range profiles() {
+			for _, stack := range profile.Stacks {
+				Expect(stacks).NotTo(HaveKey(stack), "stack %s is in profiles %s and %s", stack, stacks[stack], profile.Name)
+				stacks[stack] = profile.Name
+			}
+		}
+	})
+
+	it("should return the packages of distros other than UBI", func() {
+		nodeProfile, err := utils.GetNodeProfile("io.buildpacks.stacks.rocky9", "amd64", 20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetBuildPackages()).To(Equal([]string{"make", "gcc", "gcc-c++", "git", "openssl-devel", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper-libs", "python3"}))
+
+		nodeProfile, err = utils.GetNodeProfile("io.buildpacks.stacks.fedora42", "amd64", 22)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetRunPackages()).To(Equal([]string{"nodejs22", "nodejs22-npm"}))
+
+		profile, err := utils.GetDistroProfile("io.buildpacks.stacks.centos-stream9")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profile.EnableNodejsModule).To(BeTrue())
+
+		profile, err = utils.GetDistroProfile("io.buildpacks.stacks.fedora42")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profile.EnableNodejsModule).To(BeFalse())
+	})
+
+	it("should return the symlinks of the profile", func() {
+		nodeProfile, err := utils.GetNodeProfile("io.buildpacks.stacks.fedora42", "amd64", 20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetSymlinks()).To(Equal([]structs.Symlink{
+			{Link: "/usr/bin/node", Target: "/usr/bin/node-20", Force: true},
+			{Link: "/usr/bin/npm", Target: "/usr/bin/npm-20", Force: true},
+			{Link: "/usr/bin/npx", Target: "/usr/bin/npx-20", Force: true},
+		}))
+
+		nodeProfile, err = utils.GetNodeProfile("io.buildpacks.stacks.alma8", "amd64", 22)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetSymlinks()).To(ContainElement(structs.Symlink{Link: "/usr/bin/gcc", Target: "/opt/rh/gcc-toolset-13/root/usr/bin/gcc", Force: true}))
+		Expect(nodeProfile.GetRunSymlinks()).To(BeEmpty())
+	})
+
+	it("should render the run image of the profile, if any", func() {
+		profile, err := utils.GetDistroProfile("io.buildpacks.stacks.ubi10")
+		Expect(err).NotTo(HaveOccurred())
+
+		runImage, err := profile.GetRunImage("24", "ubi10")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runImage).To(Equal("paketobuildpacks/ubi-10-run-nodejs-24-base"))
+
+		profile, err = utils.GetDistroProfile("io.buildpacks.stacks.rocky9")
+		Expect(err).NotTo(HaveOccurred())
+
+		runImage, err = profile.GetRunImage("20", "rocky9")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runImage).To(BeEmpty())
+	})
+
+	context("selecting the packages of an architecture", func() {
+		var node utils.NodeProfile
+
+		it.Before(func() {
+			node = utils.NodeProfile{
+				Versions:      []int{22},
+				BuildPackages: []string{"gcc-toolset-13-gcc", "nodejs"},
+				RunPackages:   []string{"nodejs"},
+				Symlinks: []utils.Symlink{
+					{Link: "/usr/bin/gcc", Target: "/opt/rh/gcc-toolset-13/root/usr/bin/gcc", Force: true, BuildOnly: true},
+				},
+				Arch: map[string]utils.NodeArchProfile{
+					"s390x": {
+						BuildPackages: []string{"gcc", "nodejs"},
+						Symlinks:      []utils.Symlink{},
+					},
+				},
+			}
+		})
+
+		it("should apply the overrides of the architecture", func() {
+			s390x, err := node.ForArch("s390x", "Node.js version 22")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s390x.GetBuildPackages()).To(Equal([]string{"gcc", "nodejs"}))
+			Expect(s390x.GetRunPackages()).To(Equal([]string{"nodejs"}))
+			Expect(s390x.GetSymlinks()).To(BeEmpty())
+
+			amd64, err := node.ForArch("amd64", "Node.js version 22")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(amd64.GetBuildPackages()).To(Equal([]string{"gcc-toolset-13-gcc", "nodejs"}))
+			Expect(amd64.GetSymlinks()).To(Equal([]structs.Symlink{{Link: "/usr/bin/gcc", Target: "/opt/rh/gcc-toolset-13/root/usr/bin/gcc", Force: true}}))
+		})
+
+		it("should error for an architecture the version is not available on", func() {
+			node.Architectures = []string{"amd64", "arm64"}
+
+			_, err := node.ForArch("ppc64le", "Node.js version 22")
+			Expect(err).To(MatchError("unsupported architecture ppc64le for Node.js version 22"))
+		})
+
+		it("should provide the packages of the UBI profiles on all the targets", func() {
+			for _, arch := range []string{"amd64", "arm64", "s390x", "ppc64le"} {
+				node, err := utils.GetNodeProfile("io.buildpacks.stacks.ubi8", arch, 22)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(node.GetBuildPackages()).To(ContainElement("nodejs"))
+			}
+		})
+
+		it("should build native addons with gcc-toolset-13 on all the targets", func() {
+			for _, stackId := range []string{"io.buildpacks.stacks.ubi8", "io.buildpacks.stacks.alma8"} {
+				for _, arch := range []string{"amd64", "arm64", "s390x", "ppc64le"} {
+					nodeProfile, err := utils.GetNodeProfile(stackId, arch, 22)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(nodeProfile.GetBuildPackages()).To(ContainElement("gcc-toolset-13-gcc-c++"))
+					Expect(nodeProfile.GetSymlinks()).To(ContainElement(structs.Symlink{Link: "/usr/bin/g++", Target: "/opt/rh/gcc-toolset-13/root/usr/bin/g++", Force: true}))
+					Expect(nodeProfile.GetRunSymlinks()).To(BeEmpty())
+				}
+			}
+		})
+
+		it("should error for the architectures a distro is not published for", func() {
+			_, err := utils.GetNodeProfile("io.buildpacks.stacks.rocky8", "s390x", 20)
+			Expect(err).To(MatchError("unsupported architecture s390x for Node.js version 20 for image io.buildpacks.stacks.rocky8"))
+
+			_, err = utils.GetNodeProfile("io.buildpacks.stacks.rocky9", "s390x", 20)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	context("resolving the stack ID from the target distro", func() {
+
+		it("should match the major version and its minor releases", func() {
+			testCases := []struct {
+				name          string
+				version       string
+				expectedStack string
+			}{
+				{name: "rhel", version: "8.10", expectedStack: "io.buildpacks.stacks.ubi8"},
+				{name: "rhel", version: "9", expectedStack: "io.buildpacks.stacks.ubi9"},
+				{name: "rhel", version: "10.0", expectedStack: "io.buildpacks.stacks.ubi10"},
+				{name: "rocky", version: "9.5", expectedStack: "io.buildpacks.stacks.rocky9"},
+				{name: "almalinux", version: "8.10", expectedStack: "io.buildpacks.stacks.alma8"},
+				{name: "centos", version: "10", expectedStack: "io.buildpacks.stacks.centos-stream10"},
+				{name: "fedora", version: "42", expectedStack: "io.buildpacks.stacks.fedora42"},
+			}
+
+			for _, tt := range testCases {
+				stackId, err := utils.GetStackIdFromTargetDistro(tt.name, tt.version)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stackId).To(Equal(tt.expectedStack))
+			}
+		})
+
+		it("should error for unknown distros", func() {
+			_, err := utils.GetStackIdFromTargetDistro("rhel", "100")
+			Expect(err).To(MatchError("unsupported target distro: rhel 100"))
+
+			_, err = utils.GetStackIdFromTargetDistro("ubuntu", "24.04")
+			Expect(err).To(MatchError("unsupported target distro: ubuntu 24.04"))
+		})
+	})
+}
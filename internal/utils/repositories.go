@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+const RepositoriesBindingType = "dnf-repositories"
+
+// Repositories are the custom .repo files and the GPG keys of the packages
+// they provide, written to /etc/yum.repos.d and /etc/pki/rpm-gpg under their
+// own names so that the gpgkey of a repository can refer to its key file.
+type Repositories struct {
+	Files   []structs.File
+	GpgKeys []structs.File
+}
+
+// GetRepositories returns the repositories of the dnf-repositories service
+// bindings and of the files in repositoriesDir, when it is not empty. Every
+// repository has to set gpgcheck=1 unless allowUnsigned is set.
+func GetRepositories(platformPath string, repositoriesDir string, allowUnsigned bool) (Repositories, error) {
+	var repositories Repositories
+
+	bindings, err := servicebindings.NewResolver().Resolve(RepositoriesBindingType, "", platformPath)
+	if err != nil {
+		return Repositories{}, fmt.Errorf("failed to resolve %s bindings: %w", RepositoriesBindingType, err)
+	}
+
+	for _, binding := range bindings {
+		for _, name := range sortedEntryNames(binding) {
+			content, err := binding.Entries[name].ReadBytes()
+			if err != nil {
+				return Repositories{}, fmt.Errorf("failed to read entry %s of binding %s: %w", name, binding.Name, err)
+			}
+
+			err = repositories.add(name, fmt.Sprintf("entry %s of binding %s", name, binding.Name), content, allowUnsigned)
+			if err != nil {
+				return Repositories{}, err
+			}
+		}
+	}
+
+	if repositoriesDir != "" {
+		entries, err := os.ReadDir(repositoriesDir)
+		if err != nil {
+			return Repositories{}, fmt.Errorf("failed to read repositories directory: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			content, err := os.ReadFile(filepath.Join(repositoriesDir, entry.Name()))
+			if err != nil {
+				return Repositories{}, fmt.Errorf("failed to read repository file: %w", err)
+			}
+
+			err = repositories.add(entry.Name(), fmt.Sprintf("file %s", filepath.Join(repositoriesDir, entry.Name())), content, allowUnsigned)
+			if err != nil {
+				return Repositories{}, err
+			}
+		}
+	}
+
+	if len(repositories.GpgKeys) > 0 && len(repositories.Files) == 0 {
+		return Repositories{}, fmt.Errorf("GPG keys were provided without a .repo file using them")
+	}
+
+	return repositories, nil
+}
+
+func (r *Repositories) add(name string, description string, content []byte, allowUnsigned bool) error {
+	if unsafeFileNameCharacters.MatchString(name) {
+		return fmt.Errorf("%s has an unsupported file name", description)
+	}
+
+	isTaken := func(file structs.File) bool { return file.Name == name }
+	if slices.ContainsFunc(r.Files, isTaken) || slices.ContainsFunc(r.GpgKeys, isTaken) {
+		return fmt.Errorf("%s has the same name as another repository file or GPG key", description)
+	}
+
+	file := structs.File{Name: name, Content: base64.StdEncoding.EncodeToString(content)}
+
+	switch {
+	case strings.HasSuffix(name, ".repo"):
+		if err := checkRepositoryFile(content, description, allowUnsigned); err != nil {
+			return err
+		}
+		r.Files = append(r.Files, file)
+	case bytes.Contains(content, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")):
+		r.GpgKeys = append(r.GpgKeys, file)
+	default:
+		return fmt.Errorf("%s is neither a .repo file nor an ASCII armored GPG key", description)
+	}
+
+	return nil
+}
+
+// checkRepositoryFile checks that the .repo file defines at least one
+// repository and, unless allowUnsigned is set, that all of them check the
+// GPG signatures of their packages.
+func checkRepositoryFile(content []byte, description string, allowUnsigned bool) error {
+	var repositories []string
+	gpgcheck := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			repositories = append(repositories, strings.TrimSpace(line[1:len(line)-1]))
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || len(repositories) == 0 {
+			continue
+		}
+
+		if strings.TrimSpace(key) == "gpgcheck" {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "1", "true", "yes", "on":
+				gpgcheck[repositories[len(repositories)-1]] = true
+			default:
+				gpgcheck[repositories[len(repositories)-1]] = false
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", description, err)
+	}
+
+	if len(repositories) == 0 {
+		return fmt.Errorf("%s does not define a repository", description)
+	}
+
+	if allowUnsigned {
+		return nil
+	}
+
+	for _, repository := range repositories {
+		if !gpgcheck[repository] {
+			return fmt.Errorf("repository %s in %s does not set gpgcheck=1", repository, description)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package utils_test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+const (
+	internalRepository = `[internal-baseos]
+name=Internal BaseOS mirror
+baseurl=https://mirror.example.com/baseos
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-internal
+`
+	internalGpgKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQINBGRkZXN0AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA
+-----END PGP PUBLIC KEY BLOCK-----
+`
+)
+
+func testGetRepositories(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect          = NewWithT(t).Expect
+		platformDir     string
+		bindingsDir     string
+		repositoriesDir string
+	)
+
+	it.Before(func() {
+		platformDir = t.TempDir()
+		bindingsDir = filepath.Join(platformDir, "bindings")
+		repositoriesDir = t.TempDir()
+
+		// The resolver prefers these over the platform directory, even when empty
+		for _, name := range []string{"SERVICE_BINDING_ROOT", "CNB_BINDINGS", "VCAP_SERVICES"} {
+			t.Setenv(name, "")
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	it("should return no repositories without bindings or directory", func() {
+		repositories, err := utils.GetRepositories(platformDir, "", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repositories.Files).To(BeEmpty())
+		Expect(repositories.GpgKeys).To(BeEmpty())
+	})
+
+	it("should return the repositories and GPG keys of the bindings and the directory", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "mirror", "dnf-repositories", map[string][]byte{
+			"internal.repo":        []byte(internalRepository),
+			"RPM-GPG-KEY-internal": []byte(internalGpgKey),
+		})).To(Succeed())
+		appstreamRepository := []byte(`[internal-appstream]
+baseurl=https://mirror.example.com/appstream
+gpgcheck = True
+`)
+		Expect(os.WriteFile(filepath.Join(repositoriesDir, "appstream.repo"), appstreamRepository, 0644)).To(Succeed())
+
+		repositories, err := utils.GetRepositories(platformDir, repositoriesDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repositories.Files).To(Equal([]structs.File{
+			{Name: "internal.repo", Content: base64.StdEncoding.EncodeToString([]byte(internalRepository))},
+			{Name: "appstream.repo", Content: base64.StdEncoding.EncodeToString(appstreamRepository)},
+		}))
+		Expect(repositories.GpgKeys).To(Equal([]structs.File{
+			{Name: "RPM-GPG-KEY-internal", Content: base64.StdEncoding.EncodeToString([]byte(internalGpgKey))},
+		}))
+	})
+
+	it("should fail for a repository without gpgcheck=1", func() {
+		Expect(os.WriteFile(filepath.Join(repositoriesDir, "internal.repo"), []byte(internalRepository+`
+[internal-unsigned]
+baseurl=https://mirror.example.com/unsigned
+gpgcheck=0
+`), 0644)).To(Succeed())
+
+		_, err := utils.GetRepositories(platformDir, repositoriesDir, false)
+		Expect(err).To(MatchError("repository internal-unsigned in file " + filepath.Join(repositoriesDir, "internal.repo") + " does not set gpgcheck=1"))
+
+		repositories, err := utils.GetRepositories(platformDir, repositoriesDir, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repositories.Files).To(HaveLen(1))
+	})
+
+	it("should fail for a .repo file without repositories", func() {
+		Expect(os.WriteFile(filepath.Join(repositoriesDir, "empty.repo"), []byte("# nothing here\n"), 0644)).To(Succeed())
+
+		_, err := utils.GetRepositories(platformDir, repositoriesDir, true)
+		Expect(err).To(MatchError("file " + filepath.Join(repositoriesDir, "empty.repo") + " does not define a repository"))
+	})
+
+	it("should fail for a file that is neither a repository nor a GPG key", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "mirror", "dnf-repositories", map[string][]byte{
+			"internal.repo": []byte(internalRepository),
+			"notes.txt":     []byte("some notes"),
+		})).To(Succeed())
+
+		_, err := utils.GetRepositories(platformDir, "", false)
+		Expect(err).To(MatchError("entry notes.txt of binding mirror is neither a .repo file nor an ASCII armored GPG key"))
+	})
+
+	it("should fail for files with the same name", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "mirror", "dnf-repositories", map[string][]byte{
+			"internal.repo": []byte(internalRepository),
+		})).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(repositoriesDir, "internal.repo"), []byte(internalRepository), 0644)).To(Succeed())
+
+		_, err := utils.GetRepositories(platformDir, repositoriesDir, false)
+		Expect(err).To(MatchError("file " + filepath.Join(repositoriesDir, "internal.repo") + " has the same name as another repository file or GPG key"))
+	})
+
+	it("should fail for GPG keys without a repository", func() {
+		Expect(os.WriteFile(filepath.Join(repositoriesDir, "RPM-GPG-KEY-internal"), []byte(internalGpgKey), 0644)).To(Succeed())
+
+		_, err := utils.GetRepositories(platformDir, repositoriesDir, false)
+		Expect(err).To(MatchError("GPG keys were provided without a .repo file using them"))
+	})
+
+	it("should fail for a missing directory", func() {
+		_, err := utils.GetRepositories(platformDir, filepath.Join(repositoriesDir, "missing"), false)
+		Expect(err).To(MatchError(ContainSubstring("failed to read repositories directory")))
+	})
+}
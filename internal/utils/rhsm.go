@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+const RHSMBindingType = "rhsm"
+
+const (
+	entitlementDir = "/etc/pki/entitlement"
+	rhsmCAPath     = "/etc/rhsm/ca/redhat-uep.pem"
+)
+
+var (
+	unsafePathCharacters = regexp.MustCompile(`[^A-Za-z0-9._/-]`)
+	repositoryID         = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._:-]*$`)
+)
+
+// GetRHSMFiles returns the files of the rhsm service binding, with the path
+// they are copied to during the package installation. Only their paths end
+// up in the generated Dockerfiles. The binding holds the entitlement
+// certificates and keys (<id>.pem and <id>-key.pem), and optionally the
+// rhsm.conf, and the redhat-uep.pem CA of the Red Hat CDN.
+func GetRHSMFiles(platformPath string) ([]structs.BindingFile, error) {
+	bindings, err := servicebindings.NewResolver().Resolve(RHSMBindingType, "", platformPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s bindings: %w", RHSMBindingType, err)
+	}
+
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+	if len(bindings) > 1 {
+		return nil, fmt.Errorf("found %d %s bindings, expected at most one", len(bindings), RHSMBindingType)
+	}
+
+	binding := bindings[0]
+	if unsafePathCharacters.MatchString(binding.Path) {
+		return nil, fmt.Errorf("unsupported path %s of binding %s, expected letters, digits and ._/- only", binding.Path, binding.Name)
+	}
+
+	var files []structs.BindingFile
+	var hasCA bool
+	for _, name := range sortedEntryNames(binding) {
+		var filePath string
+		switch {
+		case name == "rhsm.conf":
+			filePath = "/etc/rhsm/rhsm.conf"
+		case name == "redhat-uep.pem":
+			filePath = rhsmCAPath
+			hasCA = true
+		case strings.HasSuffix(name, ".pem") && !unsafeFileNameCharacters.MatchString(name):
+			filePath = path.Join(entitlementDir, name)
+		default:
+			return nil, fmt.Errorf("unsupported entry %s of binding %s, expected rhsm.conf, redhat-uep.pem or entitlement certificates and keys", name, binding.Name)
+		}
+
+		files = append(files, structs.BindingFile{
+			Source: filepath.Join(binding.Path, name),
+			Dest:   filePath,
+		})
+	}
+
+	if _, _, ok := entitlement(files); !ok {
+		return nil, fmt.Errorf("binding %s does not contain an entitlement certificate and key", binding.Name)
+	}
+	if !hasCA {
+		return nil, fmt.Errorf("binding %s does not contain redhat-uep.pem, the CA of the Red Hat CDN", binding.Name)
+	}
+
+	return files, nil
+}
+
+// GetRHSMRepositoryFile returns the redhat.repo that gives the package
+// manager access to the repositories with the entitlement of the files, as
+// the images have no subscription-manager to generate it.
+func GetRHSMRepositoryFile(files []structs.BindingFile, repositories []EntitledRepository) (structs.File, error) {
+	certificate, key, ok := entitlement(files)
+	if !ok {
+		return structs.File{}, fmt.Errorf("no entitlement certificate and key to access the repositories with")
+	}
+
+	var content strings.Builder
+	for i, repository := range repositories {
+		if i > 0 {
+			content.WriteString("\n")
+		}
+		fmt.Fprintf(&content, "[%s]\n", repository.ID)
+		fmt.Fprintf(&content, "name = %s\n", repository.Name)
+		fmt.Fprintf(&content, "baseurl = %s\n", repository.BaseURL)
+		content.WriteString("enabled = 1\n")
+		content.WriteString("gpgcheck = 1\n")
+		fmt.Fprintf(&content, "gpgkey = %s\n", repository.GPGKey)
+		content.WriteString("sslverify = 1\n")
+		fmt.Fprintf(&content, "sslcacert = %s\n", rhsmCAPath)
+		fmt.Fprintf(&content, "sslclientcert = %s\n", certificate)
+		fmt.Fprintf(&content, "sslclientkey = %s\n", key)
+	}
+
+	return structs.File{Name: "redhat.repo", Content: base64.StdEncoding.EncodeToString([]byte(content.String()))}, nil
+}
+
+// entitlement returns the first entitlement certificate of the files that
+// comes with its key.
+func entitlement(files []structs.BindingFile) (string, string, bool) {
+	keys := map[string]bool{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Dest, "-key.pem") {
+			keys[file.Dest] = true
+		}
+	}
+	for _, file := range files {
+		if path.Dir(file.Dest) != entitlementDir || strings.HasSuffix(file.Dest, "-key.pem") {
+			continue
+		}
+		if key := strings.TrimSuffix(file.Dest, ".pem") + "-key.pem"; keys[key] {
+			return file.Dest, key, true
+		}
+	}
+	return "", "", false
+}
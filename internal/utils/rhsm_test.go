@@ -0,0 +1,159 @@
+package utils_test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetRHSMFiles(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		platformDir string
+		bindingsDir string
+	)
+
+	it.Before(func() {
+		platformDir = t.TempDir()
+		bindingsDir = filepath.Join(platformDir, "bindings")
+
+		// The resolver prefers these over the platform directory, even when empty
+		for _, name := range []string{"SERVICE_BINDING_ROOT", "CNB_BINDINGS", "VCAP_SERVICES"} {
+			t.Setenv(name, "")
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	it("should return no files without binding", func() {
+		files, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	it("should return the files with the path they are written to", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "subscription", "rhsm", map[string][]byte{
+			"1234.pem":       []byte("certificate"),
+			"1234-key.pem":   []byte("key"),
+			"rhsm.conf":      []byte("[server]"),
+			"redhat-uep.pem": []byte("ca"),
+		})).To(Succeed())
+
+		files, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(Equal([]structs.BindingFile{
+			{Source: filepath.Join(bindingsDir, "subscription", "1234-key.pem"), Dest: "/etc/pki/entitlement/1234-key.pem"},
+			{Source: filepath.Join(bindingsDir, "subscription", "1234.pem"), Dest: "/etc/pki/entitlement/1234.pem"},
+			{Source: filepath.Join(bindingsDir, "subscription", "redhat-uep.pem"), Dest: "/etc/rhsm/ca/redhat-uep.pem"},
+			{Source: filepath.Join(bindingsDir, "subscription", "rhsm.conf"), Dest: "/etc/rhsm/rhsm.conf"},
+		}))
+	})
+
+	it("should fail without an entitlement key", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "subscription", "rhsm", map[string][]byte{
+			"1234.pem": []byte("certificate"),
+		})).To(Succeed())
+
+		_, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).To(MatchError("binding subscription does not contain an entitlement certificate and key"))
+	})
+
+	it("should fail for a key of another certificate", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "subscription", "rhsm", map[string][]byte{
+			"1234.pem":       []byte("certificate"),
+			"5678-key.pem":   []byte("key"),
+			"redhat-uep.pem": []byte("ca"),
+		})).To(Succeed())
+
+		_, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).To(MatchError("binding subscription does not contain an entitlement certificate and key"))
+	})
+
+	it("should fail without the CA of the Red Hat CDN", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "subscription", "rhsm", map[string][]byte{
+			"1234.pem":     []byte("certificate"),
+			"1234-key.pem": []byte("key"),
+		})).To(Succeed())
+
+		_, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).To(MatchError("binding subscription does not contain redhat-uep.pem, the CA of the Red Hat CDN"))
+	})
+
+	it("should fail for an unsupported entry", func() {
+		Expect(testhelpers.WriteServiceBinding(bindingsDir, "subscription", "rhsm", map[string][]byte{
+			"1234.pem":     []byte("certificate"),
+			"1234-key.pem": []byte("key"),
+			"password":     []byte("secret"),
+		})).To(Succeed())
+
+		_, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).To(MatchError("unsupported entry password of binding subscription, expected rhsm.conf, redhat-uep.pem or entitlement certificates and keys"))
+	})
+
+	it("should fail for more than one binding", func() {
+		for _, name := range []string{"first", "second"} {
+			Expect(testhelpers.WriteServiceBinding(bindingsDir, name, "rhsm", map[string][]byte{
+				"1234.pem":     []byte("certificate"),
+				"1234-key.pem": []byte("key"),
+			})).To(Succeed())
+		}
+
+		_, err := utils.GetRHSMFiles(platformDir)
+		Expect(err).To(MatchError("found 2 rhsm bindings, expected at most one"))
+	})
+
+	context("GetRHSMRepositoryFile", func() {
+
+		it("should give access to the entitled repositories of the profile with the entitlement", func() {
+			distroProfile, err := utils.GetDistroProfile("io.buildpacks.stacks.ubi9")
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err := utils.GetRHSMRepositoryFile([]structs.BindingFile{
+				{Source: "/platform/bindings/subscription/1234-key.pem", Dest: "/etc/pki/entitlement/1234-key.pem"},
+				{Source: "/platform/bindings/subscription/1234.pem", Dest: "/etc/pki/entitlement/1234.pem"},
+				{Source: "/platform/bindings/subscription/redhat-uep.pem", Dest: "/etc/rhsm/ca/redhat-uep.pem"},
+			}, distroProfile.EntitledRepositories)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Name).To(Equal("redhat.repo"))
+
+			content, err := base64.StdEncoding.DecodeString(file.Content)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(`[rhel-9-for-baseos-rpms]
+name = Red Hat Enterprise Linux 9 for $basearch - BaseOS (RPMs)
+baseurl = https://cdn.redhat.com/content/dist/rhel9/9/$basearch/baseos/os
+enabled = 1
+gpgcheck = 1
+gpgkey = file:///etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release
+sslverify = 1
+sslcacert = /etc/rhsm/ca/redhat-uep.pem
+sslclientcert = /etc/pki/entitlement/1234.pem
+sslclientkey = /etc/pki/entitlement/1234-key.pem
+
+[rhel-9-for-appstream-rpms]
+name = Red Hat Enterprise Linux 9 for $basearch - AppStream (RPMs)
+baseurl = https://cdn.redhat.com/content/dist/rhel9/9/$basearch/appstream/os
+enabled = 1
+gpgcheck = 1
+gpgkey = file:///etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release
+sslverify = 1
+sslcacert = /etc/rhsm/ca/redhat-uep.pem
+sslclientcert = /etc/pki/entitlement/1234.pem
+sslclientkey = /etc/pki/entitlement/1234-key.pem
+`))
+		})
+
+		it("should fail without an entitlement certificate and key", func() {
+			_, err := utils.GetRHSMRepositoryFile([]structs.BindingFile{
+				{Source: "/platform/bindings/subscription/redhat-uep.pem", Dest: "/etc/rhsm/ca/redhat-uep.pem"},
+			}, nil)
+			Expect(err).To(MatchError("no entitlement certificate and key to access the repositories with"))
+		})
+	})
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var rpmArchitectures = map[string]bool{
+	"x86_64":  true,
+	"aarch64": true,
+	"ppc64le": true,
+	"s390x":   true,
+	"i686":    true,
+	"noarch":  true,
+}
+
+// rpmVersion is the epoch, version and release of an RPM package, the epoch
+// and release being empty when they are not known.
+type rpmVersion struct {
+	epoch   string
+	version string
+	release string
+}
+
+// parseRPMVersion parses an [epoch:]version[-release], such as the fixed
+// versions of the feeds, or an upstream version prefixed with a v.
+func parseRPMVersion(value string) (rpmVersion, error) {
+	var v rpmVersion
+
+	rest := value
+	if epoch, after, found := strings.Cut(rest, ":"); found {
+		if _, err := strconv.ParseUint(epoch, 10, 64); err != nil {
+			return rpmVersion{}, fmt.Errorf("invalid epoch in '%s'", value)
+		}
+		v.epoch, rest = epoch, after
+	}
+
+	if i := strings.LastIndex(rest, "-"); i >= 0 {
+		rest, v.release = rest[:i], rest[i+1:]
+		if v.release == "" {
+			return rpmVersion{}, fmt.Errorf("empty release in '%s'", value)
+		}
+	}
+
+	if v.epoch == "" && len(rest) > 1 && rest[0] == 'v' {
+		rest = rest[1:]
+	}
+	if rest == "" || !unicode.IsDigit(rune(rest[0])) {
+		return rpmVersion{}, fmt.Errorf("version of '%s' does not start with a digit", value)
+	}
+	v.version = rest
+
+	return v, nil
+}
+
+// parseNodejsPackage parses the Node.js package as the run images declare it,
+// a name-[epoch:]version-release[.arch], as rpm -q prints it, or only its
+// version.
+func parseNodejsPackage(value string) (rpmVersion, error) {
+	if value == "" || unicode.IsDigit(rune(value[0])) || (value[0] == 'v' && len(value) > 1 && unicode.IsDigit(rune(value[1]))) {
+		return parseRPMVersion(value)
+	}
+
+	nevr := value
+	if i := strings.LastIndex(nevr, "."); i >= 0 && rpmArchitectures[nevr[i+1:]] {
+		nevr = nevr[:i]
+	}
+
+	releaseIndex := strings.LastIndex(nevr, "-")
+	if releaseIndex < 0 {
+		return rpmVersion{}, fmt.Errorf("'%s' is not a name-version-release", value)
+	}
+	nameIndex := strings.LastIndex(nevr[:releaseIndex], "-")
+	if nameIndex < 0 {
+		return rpmVersion{}, fmt.Errorf("'%s' is not a name-version-release", value)
+	}
+
+	if !nodejsPackageNames[nevr[:nameIndex]] {
+		return rpmVersion{}, fmt.Errorf("'%s' is not a Node.js package", value)
+	}
+
+	return parseRPMVersion(nevr[nameIndex+1:])
+}
+
+// isExact reports whether the version names a single Node.js version, rather
+// than the stream of its major version as NODEJS_VERSION=20 does.
+func (v rpmVersion) isExact() bool {
+	return v.release != "" || strings.Count(v.version, ".") >= 2
+}
+
+// major returns the leading number of the version.
+func (v rpmVersion) major() uint64 {
+	end := strings.IndexFunc(v.version, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		end = len(v.version)
+	}
+	major, _ := strconv.ParseUint(v.version[:end], 10, 64)
+	return major
+}
+
+// compare compares the versions the way rpm does, a missing epoch being 0,
+// and leaves out the releases unless both versions have them, as rpm does for
+// a version without a release.
+func (v rpmVersion) compare(other rpmVersion) int {
+	if result := compareRPMSegments(v.epochOrZero(), other.epochOrZero()); result != 0 {
+		return result
+	}
+
+	if result := compareRPMSegments(v.version, other.version); result != 0 {
+		return result
+	}
+
+	if v.release != "" && other.release != "" {
+		return compareRPMSegments(v.release, other.release)
+	}
+	return 0
+}
+
+func (v rpmVersion) epochOrZero() string {
+	if v.epoch == "" {
+		return "0"
+	}
+	return v.epoch
+}
+
+func (v rpmVersion) String() string {
+	s := v.version
+	if v.epoch != "" {
+		s = v.epoch + ":" + s
+	}
+	if v.release != "" {
+		s += "-" + v.release
+	}
+	return s
+}
+
+// compareRPMSegments is rpmvercmp: the strings are compared segment by
+// segment, numeric segments numerically and newer than alphabetic ones, a ~
+// sorting before anything and a ^ after the end of the string.
+func compareRPMSegments(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isSeparator := func(c byte) bool {
+		return !isRPMDigit(c) && !isRPMLetter(c) && c != '~' && c != '^'
+	}
+
+	for a != "" || b != "" {
+		for a != "" && isSeparator(a[0]) {
+			a = a[1:]
+		}
+		for b != "" && isSeparator(b[0]) {
+			b = b[1:]
+		}
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		isNumeric := isRPMDigit(a[0])
+		inSegment := isRPMLetter
+		if isNumeric {
+			inSegment = isRPMDigit
+		}
+
+		aEnd, bEnd := 0, 0
+		for aEnd < len(a) && inSegment(a[aEnd]) {
+			aEnd++
+		}
+		for bEnd < len(b) && inSegment(b[bEnd]) {
+			bEnd++
+		}
+
+		// Segments of different types, numeric ones are newer
+		if bEnd == 0 {
+			if isNumeric {
+				return 1
+			}
+			return -1
+		}
+
+		aSegment, bSegment := a[:aEnd], b[:bEnd]
+		a, b = a[aEnd:], b[bEnd:]
+
+		if isNumeric {
+			aSegment = strings.TrimLeft(aSegment, "0")
+			bSegment = strings.TrimLeft(bSegment, "0")
+			if len(aSegment) != len(bSegment) {
+				if len(aSegment) > len(bSegment) {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		if result := strings.Compare(aSegment, bSegment); result != 0 {
+			return result
+		}
+	}
+
+	if a == "" && b == "" {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	return 1
+}
+
+func isRPMDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isRPMLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
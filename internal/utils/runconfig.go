@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// RunEnvPrefix prefixes the variables of the environment that are set in the
+// run image without it, e.g. BP_UBI_RUN_ENV_NODE_ENV sets NODE_ENV.
+const RunEnvPrefix = "BP_UBI_RUN_ENV_"
+
+var runUser = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// RunConfig is the configuration file of the run image.
+type RunConfig struct {
+	User string            `toml:"user"`
+	Env  map[string]string `toml:"env"`
+}
+
+// GetRunConfig returns the environment variables, sorted by name, and the
+// user of the run image. They are read from the RunConfig TOML file at
+// configPath, when not empty, and from the RunEnvPrefix variables and
+// BP_UBI_RUN_USER of environ, which take precedence.
+func GetRunConfig(configPath string, environ []string) ([]structs.EnvVar, string, error) {
+	var config RunConfig
+	if configPath != "" {
+		if _, err := toml.DecodeFile(configPath, &config); err != nil {
+			return nil, "", fmt.Errorf("failed to parse run image configuration %s: %w", configPath, err)
+		}
+	}
+
+	values := map[string]string{}
+	for name, value := range config.Env {
+		values[name] = value
+	}
+
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		if name == "BP_UBI_RUN_USER" && value != "" {
+			config.User = value
+		}
+		if strings.HasPrefix(name, RunEnvPrefix) {
+			values[strings.TrimPrefix(name, RunEnvPrefix)] = value
+		}
+	}
+
+	var env []structs.EnvVar
+	for name, value := range values {
+		if !buildArgName.MatchString(name) {
+			return nil, "", fmt.Errorf("invalid run image environment variable name '%s'", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, "", fmt.Errorf("the value of run image environment variable %s must not span several lines", name)
+		}
+		env = append(env, structs.EnvVar{Name: name, Value: value})
+	}
+	slices.SortFunc(env, func(a, b structs.EnvVar) int { return strings.Compare(a.Name, b.Name) })
+
+	if config.User != "" && !runUser.MatchString(config.User) {
+		return nil, "", fmt.Errorf("invalid run image user '%s', expected a user and optionally a group, by name or ID", config.User)
+	}
+
+	return env, config.User, nil
+}
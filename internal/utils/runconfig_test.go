@@ -0,0 +1,87 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetRunConfig(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect     = NewWithT(t).Expect
+		configPath string
+	)
+
+	it.Before(func() {
+		configPath = filepath.Join(t.TempDir(), "run.toml")
+		Expect(os.WriteFile(configPath, []byte(`user = "1002:1000"
+
+[env]
+NODE_ENV = "production"
+TZ = "UTC"
+`), 0644)).To(Succeed())
+	})
+
+	it("should return nothing without a file and variables", func() {
+		env, user, err := utils.GetRunConfig("", []string{"PATH=/usr/bin"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(BeEmpty())
+		Expect(user).To(BeEmpty())
+	})
+
+	it("should return the variables of the file and of the environment, sorted by name", func() {
+		env, user, err := utils.GetRunConfig(configPath, []string{
+			"BP_UBI_RUN_ENV_TZ=Europe/Berlin",
+			"BP_UBI_RUN_ENV_NODE_OPTIONS=--max-old-space-size=512",
+			"BP_UBI_RUN_ENV_LANG=C.UTF-8",
+			"BP_UBI_RUN_USER=node",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal([]structs.EnvVar{
+			{Name: "LANG", Value: "C.UTF-8"},
+			{Name: "NODE_ENV", Value: "production"},
+			{Name: "NODE_OPTIONS", Value: "--max-old-space-size=512"},
+			{Name: "TZ", Value: "Europe/Berlin"},
+		}))
+		Expect(user).To(Equal("node"))
+	})
+
+	it("should return the user of the file", func() {
+		_, user, err := utils.GetRunConfig(configPath, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("1002:1000"))
+	})
+
+	context("Failure cases", func() {
+
+		it("should error for an invalid variable name", func() {
+			_, _, err := utils.GetRunConfig("", []string{"BP_UBI_RUN_ENV_NODE-ENV=production"})
+			Expect(err).To(MatchError("invalid run image environment variable name 'NODE-ENV'"))
+		})
+
+		it("should error for a value with several lines", func() {
+			Expect(os.WriteFile(configPath, []byte("[env]\nMOTD = \"hello\\nworld\"\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.GetRunConfig(configPath, nil)
+			Expect(err).To(MatchError("the value of run image environment variable MOTD must not span several lines"))
+		})
+
+		it("should error for an invalid user", func() {
+			_, _, err := utils.GetRunConfig("", []string{"BP_UBI_RUN_USER=node:node:node"})
+			Expect(err).To(MatchError("invalid run image user 'node:node:node', expected a user and optionally a group, by name or ID"))
+		})
+
+		it("should error for a file that is not TOML", func() {
+			Expect(os.WriteFile(configPath, []byte("NODE_ENV=production\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.GetRunConfig(configPath, nil)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse run image configuration")))
+		})
+	})
+}
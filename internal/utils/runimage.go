@@ -0,0 +1,692 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ociRefNameAnnotation        = "org.opencontainers.image.ref.name"
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+
+	dockerHubRegistry    = "index.docker.io"
+	dockerHubAPIRegistry = "registry-1.docker.io"
+
+	defaultDockerSocket = "/var/run/docker.sock"
+	nodejsVersionEnv    = "NODEJS_VERSION"
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+
+	// Name is the repository part of the reference exactly as it was given,
+	// without any tag or digest.
+	Name string
+}
+
+type ImageSignature struct {
+	Payload     []byte
+	Signature   []byte
+	Certificate []byte
+	Chain       []byte
+
+	// Bundle is the Rekor bundle of the signature, recording when the
+	// transparency log integrated it.
+	Bundle []byte
+}
+
+type ImageConfig struct {
+	Labels map[string]string `json:"Labels"`
+	Env    []string          `json:"Env"`
+}
+
+type RunImageSource interface {
+	Digest(reference ImageReference) (string, error)
+	Config(reference ImageReference, arch string) (ImageConfig, error)
+	Signatures(reference ImageReference, digest string) ([]ImageSignature, error)
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociPlatformDescriptor struct {
+	ociDescriptor
+	Platform struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+type ociImageConfig struct {
+	Config ImageConfig `json:"config"`
+}
+
+func ParseImageReference(reference string) (ImageReference, error) {
+	if reference == "" {
+		return ImageReference{}, errors.New("image reference cannot be empty")
+	}
+
+	var imageReference ImageReference
+	name := reference
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		imageReference.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.HasPrefix(imageReference.Digest, "sha256:") || len(imageReference.Digest) != len("sha256:")+64 {
+			return ImageReference{}, fmt.Errorf("image reference '%s' has an invalid digest", reference)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		imageReference.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if imageReference.Tag == "" && imageReference.Digest == "" {
+		imageReference.Tag = "latest"
+	}
+	if name == "" {
+		return ImageReference{}, fmt.Errorf("image reference '%s' has no repository", reference)
+	}
+	imageReference.Name = name
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		imageReference.Registry = parts[0]
+		imageReference.Repository = parts[1]
+		if imageReference.Registry == "docker.io" {
+			imageReference.Registry = dockerHubRegistry
+		}
+		if imageReference.Registry == dockerHubRegistry && !strings.Contains(imageReference.Repository, "/") {
+			imageReference.Repository = "library/" + imageReference.Repository
+		}
+	} else {
+		imageReference.Registry = dockerHubRegistry
+		imageReference.Repository = name
+		if len(parts) == 1 {
+			imageReference.Repository = "library/" + name
+		}
+	}
+
+	return imageReference, nil
+}
+
+// String returns the reference as it was given, without the digest.
+func (r ImageReference) String() string {
+	if r.Tag == "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s:%s", r.Name, r.Tag)
+}
+
+// NewRunImageSource returns the source used to look up run image digests,
+// configs and signatures. The spec is either "oci-layout:<path>" for a local
+// OCI image layout, "docker-daemon[:<socket>]" for a Docker compatible daemon,
+// "registry" for the registry of each reference, or "registry:<url>" for a
+// registry stand-in serving every repository.
+func NewRunImageSource(spec string) (RunImageSource, error) {
+	kind, value, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "oci-layout":
+		if value == "" {
+			return nil, errors.New("run image source 'oci-layout' requires a path")
+		}
+		return OCILayoutSource{Path: value}, nil
+	case "docker-daemon":
+		if value == "" {
+			value = defaultDockerSocket
+		}
+		return NewDockerDaemonSource(value), nil
+	case "registry":
+		return RegistrySource{BaseURL: value, Client: http.DefaultClient}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported run image source '%s'", spec)
+}
+
+// RunImageNode is the Node.js a run image declares, its version and, when
+// declared as well, the name-epoch:version-release.arch of its package.
+type RunImageNode struct {
+	Version string
+	Package string
+}
+
+// CheckRunImageNodeVersion compares the Node.js version declared by the run
+// image with the selected major version and returns the declared Node.js. The
+// version is read from the given label, falling back to the NODEJS_VERSION
+// environment variable of the image, and the package from packageLabel, for
+// the target arch when the run image is a multi-arch index.
+func CheckRunImageNodeVersion(source RunImageSource, reference ImageReference, arch string, label string, packageLabel string, nodeMajorVersion uint64) (RunImageNode, error) {
+	config, err := source.Config(reference, arch)
+	if err != nil {
+		return RunImageNode{}, fmt.Errorf("failed to read config of run image %s: %w", reference, err)
+	}
+
+	declaredVersion, ok := config.Labels[label]
+	if !ok {
+		for _, variable := range config.Env {
+			if name, value, _ := strings.Cut(variable, "="); name == nodejsVersionEnv {
+				declaredVersion, ok = value, true
+			}
+		}
+	}
+
+	if !ok || declaredVersion == "" {
+		return RunImageNode{}, fmt.Errorf("run image %s does not declare a Node.js version in label %s or env %s", reference, label, nodejsVersionEnv)
+	}
+
+	node := RunImageNode{Version: declaredVersion, Package: config.Labels[packageLabel]}
+
+	declaredMajorVersion, _, _ := strings.Cut(strings.TrimPrefix(declaredVersion, "v"), ".")
+	if declaredMajorVersion != strconv.FormatUint(nodeMajorVersion, 10) {
+		return node, fmt.Errorf("run image %s provides Node.js %s but Node.js %d was selected for the build image", reference, declaredVersion, nodeMajorVersion)
+	}
+
+	if node.Package != "" {
+		nodePackage, err := parseNodejsPackage(node.Package)
+		if err != nil {
+			return node, fmt.Errorf("run image %s declares an invalid Node.js package in label %s: %w", reference, packageLabel, err)
+		}
+		if nodePackage.major() != nodeMajorVersion {
+			return node, fmt.Errorf("run image %s provides %s but Node.js %d was selected for the build image", reference, node.Package, nodeMajorVersion)
+		}
+	}
+
+	return node, nil
+}
+
+// OCILayoutSource reads images from an OCI image layout on disk. Images are
+// matched on the org.opencontainers.image.ref.name annotation of the layout
+// index, which must hold the full reference (e.g. "example.com/run:latest").
+type OCILayoutSource struct {
+	Path string
+}
+
+func (s OCILayoutSource) Digest(reference ImageReference) (string, error) {
+	if reference.Digest != "" {
+		return reference.Digest, nil
+	}
+
+	descriptor, err := s.find(reference.Name, reference.Tag)
+	if err != nil {
+		return "", err
+	}
+
+	return descriptor.Digest, nil
+}
+
+func (s OCILayoutSource) Config(reference ImageReference, arch string) (ImageConfig, error) {
+	digest, err := s.Digest(reference)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	return readImageConfig(digest, arch, s.blob, s.blob)
+}
+
+func (s OCILayoutSource) Signatures(reference ImageReference, digest string) ([]ImageSignature, error) {
+	descriptor, err := s.find(reference.Name, signatureTag(digest))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := s.blob(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSignatureManifest(manifest, s.blob)
+}
+
+func (s OCILayoutSource) find(name, tag string) (ociDescriptor, error) {
+	content, err := os.ReadFile(filepath.Join(s.Path, "index.json"))
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	var index ociManifest
+	if err := json.Unmarshal(content, &index); err != nil {
+		return ociDescriptor{}, fmt.Errorf("failed to parse OCI layout index: %w", err)
+	}
+
+	refName := fmt.Sprintf("%s:%s", name, tag)
+	for _, descriptor := range index.Manifests {
+		if descriptor.Annotations[ociRefNameAnnotation] == refName {
+			return descriptor, nil
+		}
+	}
+
+	return ociDescriptor{}, fmt.Errorf("image '%s' not found in OCI layout %s", refName, s.Path)
+}
+
+func (s OCILayoutSource) blob(digest string) ([]byte, error) {
+	algorithm, hash, found := strings.Cut(digest, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid digest '%s'", digest)
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.Path, "blobs", algorithm, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return content, verifyDigest(content, digest)
+}
+
+// RegistrySource reads images through the OCI distribution API. When BaseURL
+// is empty the registry of each reference is used; loopback registries are
+// reached over plain HTTP.
+type RegistrySource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (s RegistrySource) Digest(reference ImageReference) (string, error) {
+	if reference.Digest != "" {
+		return reference.Digest, nil
+	}
+
+	_, digest, err := s.manifest(reference, reference.Tag)
+	if err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+func (s RegistrySource) Config(reference ImageReference, arch string) (ImageConfig, error) {
+	tagOrDigest := reference.Digest
+	if tagOrDigest == "" {
+		tagOrDigest = reference.Tag
+	}
+
+	manifest := func(tagOrDigest string) ([]byte, error) {
+		content, _, err := s.manifest(reference, tagOrDigest)
+		return content, err
+	}
+
+	blob := func(digest string) ([]byte, error) {
+		return s.get(reference, fmt.Sprintf("blobs/%s", digest), nil)
+	}
+
+	return readImageConfig(tagOrDigest, arch, manifest, blob)
+}
+
+func (s RegistrySource) Signatures(reference ImageReference, digest string) ([]ImageSignature, error) {
+	manifest, _, err := s.manifest(reference, signatureTag(digest))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSignatureManifest(manifest, func(blobDigest string) ([]byte, error) {
+		content, err := s.get(reference, fmt.Sprintf("blobs/%s", blobDigest), nil)
+		if err != nil {
+			return nil, err
+		}
+		return content, verifyDigest(content, blobDigest)
+	})
+}
+
+// manifest returns the manifest and the digest of its content. The digest
+// announced by the registry is only checked against it, never trusted.
+func (s RegistrySource) manifest(reference ImageReference, tagOrDigest string) ([]byte, string, error) {
+	var announcedDigest string
+	content, err := s.get(reference, fmt.Sprintf("manifests/%s", tagOrDigest), func(response *http.Response) {
+		announcedDigest = response.Header.Get("Docker-Content-Digest")
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	digest := sha256Digest(content)
+	if strings.HasPrefix(tagOrDigest, "sha256:") && tagOrDigest != digest {
+		return nil, "", fmt.Errorf("manifest %s of %s has digest %s", tagOrDigest, reference.Name, digest)
+	}
+	if announcedDigest != "" && announcedDigest != digest {
+		return nil, "", fmt.Errorf("registry announced digest %s for manifest %s of %s with digest %s", announcedDigest, tagOrDigest, reference.Name, digest)
+	}
+
+	return content, digest, nil
+}
+
+func (s RegistrySource) get(reference ImageReference, path string, inspect func(*http.Response)) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/v2/%s/%s", s.registryURL(reference), reference.Repository, path)
+
+	response, err := s.do(endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		_ = response.Body.Close()
+
+		token, err := s.anonymousToken(challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err = s.do(endpoint, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: unexpected status %s", endpoint, response.Status)
+	}
+
+	if inspect != nil {
+		inspect(response)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+func (s RegistrySource) do(endpoint, token string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return s.client().Do(request)
+}
+
+func (s RegistrySource) anonymousToken(challenge string) (string, error) {
+	scheme, parameters, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported registry authentication challenge '%s'", challenge)
+	}
+
+	values := map[string]string{}
+	for _, parameter := range strings.Split(parameters, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("invalid registry authentication realm in '%s'", challenge)
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	response, err := s.client().Get(realm.String())
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch registry token: unexpected status %s", response.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+func (s RegistrySource) registryURL(reference ImageReference) string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+
+	host := reference.Registry
+	if host == dockerHubRegistry {
+		host = dockerHubAPIRegistry
+	}
+
+	hostname := strings.Split(host, ":")[0]
+	if hostname == "localhost" || hostname == "127.0.0.1" {
+		return "http://" + host
+	}
+
+	return "https://" + host
+}
+
+func (s RegistrySource) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// DockerDaemonSource reads images from a Docker compatible daemon through its
+// API socket. The daemon does not keep signatures, so it can only be used to
+// inspect run images.
+type DockerDaemonSource struct {
+	Client *http.Client
+}
+
+func NewDockerDaemonSource(socketPath string) DockerDaemonSource {
+	return DockerDaemonSource{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+type dockerImageInspect struct {
+	RepoDigests []string    `json:"RepoDigests"`
+	Config      ImageConfig `json:"Config"`
+}
+
+func (s DockerDaemonSource) Digest(reference ImageReference) (string, error) {
+	if reference.Digest != "" {
+		return reference.Digest, nil
+	}
+
+	image, err := s.inspect(reference)
+	if err != nil {
+		return "", err
+	}
+
+	for _, repoDigest := range image.RepoDigests {
+		name, digest, _ := strings.Cut(repoDigest, "@")
+		repoReference, err := ParseImageReference(name)
+		if err == nil && repoReference.Registry == reference.Registry && repoReference.Repository == reference.Repository {
+			return digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("docker daemon has no repository digest for image %s", reference)
+}
+
+// Config returns the config of the image the daemon has, which is already
+// the one of its platform.
+func (s DockerDaemonSource) Config(reference ImageReference, _ string) (ImageConfig, error) {
+	image, err := s.inspect(reference)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	return image.Config, nil
+}
+
+func (s DockerDaemonSource) Signatures(reference ImageReference, _ string) ([]ImageSignature, error) {
+	return nil, fmt.Errorf("docker daemon source does not provide signatures for image %s", reference)
+}
+
+func (s DockerDaemonSource) inspect(reference ImageReference) (dockerImageInspect, error) {
+	name := reference.String()
+	if reference.Digest != "" {
+		name = fmt.Sprintf("%s@%s", reference.Name, reference.Digest)
+	}
+
+	response, err := s.Client.Get(fmt.Sprintf("http://docker/images/%s/json", url.PathEscape(name)))
+	if err != nil {
+		return dockerImageInspect{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return dockerImageInspect{}, fmt.Errorf("failed to inspect image %s: unexpected status %s", name, response.Status)
+	}
+
+	var image dockerImageInspect
+	if err := json.NewDecoder(response.Body).Decode(&image); err != nil {
+		return dockerImageInspect{}, err
+	}
+
+	return image, nil
+}
+
+// readImageConfig follows a manifest, or the linux manifest of arch when it
+// is an index, to the image config.
+func readImageConfig(manifestReference, arch string, manifest, blob func(string) ([]byte, error)) (ImageConfig, error) {
+	content, err := manifest(manifestReference)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	var imageManifest struct {
+		Config    ociDescriptor           `json:"config"`
+		Manifests []ociPlatformDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(content, &imageManifest); err != nil {
+		return ImageConfig{}, fmt.Errorf("failed to parse image manifest: %w", err)
+	}
+
+	if len(imageManifest.Manifests) > 0 {
+		for _, descriptor := range imageManifest.Manifests {
+			if descriptor.Platform.OS == "linux" && descriptor.Platform.Architecture == arch {
+				return readImageConfig(descriptor.Digest, arch, manifest, blob)
+			}
+		}
+		return ImageConfig{}, fmt.Errorf("image index %s has no linux/%s image", manifestReference, arch)
+	}
+
+	configContent, err := blob(imageManifest.Config.Digest)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+
+	var config ociImageConfig
+	if err := json.Unmarshal(configContent, &config); err != nil {
+		return ImageConfig{}, fmt.Errorf("failed to parse image config: %w", err)
+	}
+
+	return config.Config, nil
+}
+
+func parseSignatureManifest(content []byte, blob func(digest string) ([]byte, error)) ([]ImageSignature, error) {
+	var manifest ociManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse signature manifest: %w", err)
+	}
+
+	var signatures []ImageSignature
+	for _, layer := range manifest.Layers {
+		encodedSignature, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		signature, err := decodeBase64(encodedSignature)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signature of layer %s: %w", layer.Digest, err)
+		}
+
+		payload, err := blob(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		signatures = append(signatures, ImageSignature{
+			Payload:     payload,
+			Signature:   signature,
+			Certificate: []byte(layer.Annotations[cosignCertificateAnnotation]),
+			Chain:       []byte(layer.Annotations[cosignChainAnnotation]),
+			Bundle:      []byte(layer.Annotations[cosignBundleAnnotation]),
+		})
+	}
+
+	if len(signatures) == 0 {
+		return nil, errors.New("signature manifest does not contain any signatures")
+	}
+
+	return signatures, nil
+}
+
+func signatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func verifyDigest(content []byte, digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest algorithm in '%s'", digest)
+	}
+
+	if actual := sha256Digest(content); actual != digest {
+		return fmt.Errorf("content digest %s does not match expected digest %s", actual, digest)
+	}
+
+	return nil
+}
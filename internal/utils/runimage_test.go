@@ -0,0 +1,293 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testParseImageReference(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("parses the registry, repository, tag and digest", func() {
+		digest := "sha256:" + strings.Repeat("a", 64)
+
+		testCases := []struct {
+			reference string
+			expected  utils.ImageReference
+		}{
+			{
+				reference: "node",
+				expected:  utils.ImageReference{Registry: "index.docker.io", Repository: "library/node", Tag: "latest", Name: "node"},
+			},
+			{
+				reference: "paketobuildpacks/run-nodejs-18-ubi8-base",
+				expected:  utils.ImageReference{Registry: "index.docker.io", Repository: "paketobuildpacks/run-nodejs-18-ubi8-base", Tag: "latest", Name: "paketobuildpacks/run-nodejs-18-ubi8-base"},
+			},
+			{
+				reference: "localhost:5000/my-run-image:1.0",
+				expected:  utils.ImageReference{Registry: "localhost:5000", Repository: "my-run-image", Tag: "1.0", Name: "localhost:5000/my-run-image"},
+			},
+			{
+				reference: "registry.example.com/team/run@" + digest,
+				expected:  utils.ImageReference{Registry: "registry.example.com", Repository: "team/run", Digest: digest, Name: "registry.example.com/team/run"},
+			},
+		}
+
+		for _, tt := range testCases {
+			reference, err := utils.ParseImageReference(tt.reference)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reference).To(Equal(tt.expected))
+		}
+	})
+
+	it("errors on invalid references", func() {
+		for _, reference := range []string{"", "image@sha256:1234", ":tag"} {
+			_, err := utils.ParseImageReference(reference)
+			Expect(err).To(HaveOccurred(), reference)
+		}
+	})
+}
+
+func testCheckRunImageNodeVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+
+		layout    *testhelpers.OCILayout
+		reference utils.ImageReference
+	)
+
+	it.Before(func() {
+		var err error
+		layout, err = testhelpers.NewOCILayout(filepath.Join(t.TempDir(), "layout"))
+		Expect(err).NotTo(HaveOccurred())
+
+		reference, err = utils.ParseImageReference("paketobuildpacks/run-nodejs-20-ubi9-base")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	context("when the run image declares the Node.js version in a label", func() {
+		it.Before(func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{
+				"config": map[string]interface{}{
+					"Labels": map[string]string{"io.paketo.ubi-nodejs.node.version": "20.11.1"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("returns the declared version when the major matches", func() {
+			node, err := utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(node.Version).To(Equal("20.11.1"))
+		})
+
+		it("reads the config through a registry", func() {
+			server := httptest.NewServer(registryHandler(layout.Path))
+			defer server.Close()
+
+			node, err := utils.CheckRunImageNodeVersion(utils.RegistrySource{BaseURL: server.URL}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(node.Version).To(Equal("20.11.1"))
+		})
+
+		it("errors when the major does not match", func() {
+			node, err := utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 22)
+			Expect(err).To(MatchError("run image paketobuildpacks/run-nodejs-20-ubi9-base:latest provides Node.js 20.11.1 but Node.js 22 was selected for the build image"))
+			Expect(node.Version).To(Equal("20.11.1"))
+		})
+	})
+
+	context("when the run image declares the Node.js version in its environment", func() {
+		it("falls back to NODEJS_VERSION", func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{
+				"config": map[string]interface{}{
+					"Env": []string{"PATH=/usr/bin", "NODEJS_VERSION=20"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			node, err := utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(node.Version).To(Equal("20"))
+		})
+	})
+
+	context("when the run image declares the Node.js package", func() {
+		it("returns the package", func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{
+				"config": map[string]interface{}{
+					"Labels": map[string]string{
+						"io.paketo.ubi-nodejs.node.version": "20.11.1",
+						"io.paketo.ubi-nodejs.node.package": "nodejs-1:20.11.1-1.module+el9.3.0+21384+8b6b5a12.x86_64",
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			node, err := utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(node).To(Equal(utils.RunImageNode{
+				Version: "20.11.1",
+				Package: "nodejs-1:20.11.1-1.module+el9.3.0+21384+8b6b5a12.x86_64",
+			}))
+		})
+
+		it("errors when the package is of another major", func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{
+				"config": map[string]interface{}{
+					"Labels": map[string]string{
+						"io.paketo.ubi-nodejs.node.version": "20.11.1",
+						"io.paketo.ubi-nodejs.node.package": "nodejs-1:18.19.0-1.module+el9.3.0.x86_64",
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).To(MatchError("run image paketobuildpacks/run-nodejs-20-ubi9-base:latest provides nodejs-1:18.19.0-1.module+el9.3.0.x86_64 but Node.js 20 was selected for the build image"))
+		})
+
+		it("errors when the package is not Node.js", func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{
+				"config": map[string]interface{}{
+					"Labels": map[string]string{
+						"io.paketo.ubi-nodejs.node.version": "20.11.1",
+						"io.paketo.ubi-nodejs.node.package": "openssl-1:3.0.7-25.el9.x86_64",
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).To(MatchError(ContainSubstring("declares an invalid Node.js package in label io.paketo.ubi-nodejs.node.package: 'openssl-1:3.0.7-25.el9.x86_64' is not a Node.js package")))
+		})
+	})
+
+	context("when the run image does not declare a Node.js version", func() {
+		it("errors", func() {
+			_, err := layout.AddImage("paketobuildpacks/run-nodejs-20-ubi9-base:latest", map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = utils.CheckRunImageNodeVersion(utils.OCILayoutSource{Path: layout.Path}, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).To(MatchError(ContainSubstring("does not declare a Node.js version")))
+		})
+	})
+
+	context("when the run image is read from a docker daemon", func() {
+		var (
+			socketPath string
+			server     *httptest.Server
+		)
+
+		it.Before(func() {
+			socketPath = filepath.Join(t.TempDir(), "docker.sock")
+			listener, err := net.Listen("unix", socketPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/images/paketobuildpacks/run-nodejs-20-ubi9-base:latest/json" {
+					http.NotFound(w, r)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"RepoDigests": []string{"paketobuildpacks/run-nodejs-20-ubi9-base@sha256:" + strings.Repeat("c", 64)},
+					"Config": map[string]interface{}{
+						"Labels": map[string]string{"io.paketo.ubi-nodejs.node.version": "20"},
+					},
+				})
+			}))
+			server.Listener = listener
+			server.Start()
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("inspects the image through the socket", func() {
+			source, err := utils.NewRunImageSource("docker-daemon:" + socketPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			node, err := utils.CheckRunImageNodeVersion(source, reference, "amd64", "io.paketo.ubi-nodejs.node.version", "io.paketo.ubi-nodejs.node.package", 20)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(node.Version).To(Equal("20"))
+
+			digest, err := source.Digest(reference)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal("sha256:" + strings.Repeat("c", 64)))
+		})
+	})
+}
+
+// registryHandler serves the images of an OCI layout through the
+// distribution API, the same way a registry would.
+func registryHandler(layoutPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+
+		if i := strings.Index(path, "/blobs/"); i >= 0 {
+			digest := path[i+len("/blobs/"):]
+			content, err := os.ReadFile(filepath.Join(layoutPath, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:")))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(content)
+			return
+		}
+
+		i := strings.Index(path, "/manifests/")
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		repository, tag := path[:i], path[i+len("/manifests/"):]
+
+		content, err := os.ReadFile(filepath.Join(layoutPath, "index.json"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var index struct {
+			Manifests []struct {
+				Digest      string            `json:"digest"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"manifests"`
+		}
+		if err := json.Unmarshal(content, &index); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, manifest := range index.Manifests {
+			if manifest.Annotations["org.opencontainers.image.ref.name"] == repository+":"+tag {
+				content, err := os.ReadFile(filepath.Join(layoutPath, "blobs", "sha256", strings.TrimPrefix(manifest.Digest, "sha256:")))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Docker-Content-Digest", manifest.Digest)
+				_, _ = w.Write(content)
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/paketosbom"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+//go:embed templates/sbom.js
+var sbomScript []byte
+
+// purlNamespaces maps the distros whose RPMs use a different vendor in
+// package URLs than the distro name.
+var purlNamespaces = map[string]string{
+	"rhel": "redhat",
+}
+
+type sbomMetadata struct {
+	Name     string   `json:"name"`
+	Distro   string   `json:"distro"`
+	PURL     string   `json:"purl,omitempty"`
+	CPE      string   `json:"cpe,omitempty"`
+	Licenses []string `json:"licenses,omitempty"`
+}
+
+// GetSBOM returns the SBOM written into the images by the generated
+// Dockerfiles, listing the Node.js runtime of the bill of materials of the
+// dependency and the RPMs of the distro that were installed.
+func GetSBOM(entries []packit.BOMEntry, distro string) (structs.SBOM, error) {
+	if len(entries) != 1 {
+		return structs.SBOM{}, fmt.Errorf("expected the bill of materials of the Node.js dependency, got %d entries", len(entries))
+	}
+
+	metadata := sbomMetadata{Name: entries[0].Name, Distro: distro}
+	if metadata.Name == "" {
+		metadata.Name = "node"
+	}
+	if namespace, ok := purlNamespaces[distro]; ok {
+		metadata.Distro = namespace
+	}
+	if bomMetadata, ok := entries[0].Metadata.(paketosbom.BOMMetadata); ok {
+		metadata.PURL = bomMetadata.PURL
+		metadata.CPE = bomMetadata.CPE
+		metadata.Licenses = bomMetadata.Licenses
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return structs.SBOM{}, err
+	}
+
+	return structs.SBOM{
+		Path:     constants.SBOM_PATH,
+		Script:   base64.StdEncoding.EncodeToString(sbomScript),
+		Metadata: base64.StdEncoding.EncodeToString(content),
+	}, nil
+}
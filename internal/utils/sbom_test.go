@@ -0,0 +1,58 @@
+package utils_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/paketosbom"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetSBOM(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		decode = func(value string) string {
+			content, err := base64.StdEncoding.DecodeString(value)
+			Expect(err).NotTo(HaveOccurred())
+			return string(content)
+		}
+	)
+
+	it("should return the metadata of the bill of materials of the dependency", func() {
+		sbom, err := utils.GetSBOM([]packit.BOMEntry{{
+			Name: "node",
+			Metadata: paketosbom.BOMMetadata{
+				Version:  "20.1000",
+				PURL:     "pkg:generic/node@v20.11.1",
+				CPE:      "cpe:2.3:a:nodejs:node.js:20.11.1:*:*:*:*:*:*:*",
+				Licenses: []string{"MIT"},
+			},
+		}}, "rocky")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sbom.Path).To(Equal("/usr/share/sbom/ubi-nodejs-extension"))
+		Expect(decode(sbom.Metadata)).To(MatchJSON(`{
+			"name": "node",
+			"distro": "rocky",
+			"purl": "pkg:generic/node@v20.11.1",
+			"cpe": "cpe:2.3:a:nodejs:node.js:20.11.1:*:*:*:*:*:*:*",
+			"licenses": ["MIT"]
+		}`))
+		Expect(decode(sbom.Script)).To(ContainSubstring(`case "installed-since":`))
+	})
+
+	it("should use the vendor of the distro in the package URLs", func() {
+		sbom, err := utils.GetSBOM([]packit.BOMEntry{{}}, "rhel")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decode(sbom.Metadata)).To(MatchJSON(`{"name": "node", "distro": "redhat"}`))
+	})
+
+	it("should error without the bill of materials of the dependency", func() {
+		_, err := utils.GetSBOM(nil, "rhel")
+		Expect(err).To(MatchError("expected the bill of materials of the Node.js dependency, got 0 entries"))
+	})
+}
@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const cosignSignatureType = "cosign container image signature"
+
+var (
+	fulcioIssuerOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+type SignatureVerificationConfig struct {
+	// PublicKeyPath is a PEM encoded public key used to verify signatures.
+	PublicKeyPath string
+
+	// TrustRootPath is a PEM bundle of root certificates used for keyless
+	// verification. It takes precedence over PublicKeyPath when set.
+	TrustRootPath string
+
+	// CertificateIdentity and CertificateOIDCIssuer must match the signing
+	// certificate during keyless verification, as anybody can get a
+	// certificate that chains to a public trust root.
+	CertificateIdentity   string
+	CertificateOIDCIssuer string
+
+	// RekorPublicKeyPath is the PEM encoded public key of the transparency
+	// log. Keyless signatures need a log entry signed with it, which tells
+	// when the short lived signing certificate was used.
+	RekorPublicKeyPath string
+}
+
+type rekorBundle struct {
+	SignedEntryTimestamp []byte             `json:"SignedEntryTimestamp"`
+	Payload              rekorBundlePayload `json:"Payload"`
+}
+
+// rekorBundlePayload is signed in its canonical JSON form, which is how
+// encoding/json renders it as long as the fields stay sorted by name.
+type rekorBundlePayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+type hashedRekordEntry struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// VerifyRunImageSignature checks that at least one cosign signature of the
+// run image is valid for the image digest, and returns that digest.
+func VerifyRunImageSignature(source RunImageSource, reference ImageReference, config SignatureVerificationConfig) (string, error) {
+	var verifier func(ImageSignature) error
+	if config.TrustRootPath != "" {
+		if config.CertificateIdentity == "" || config.CertificateOIDCIssuer == "" {
+			return "", errors.New("keyless verification of the run image requires a certificate identity and OIDC issuer")
+		}
+		if config.RekorPublicKeyPath == "" {
+			return "", errors.New("keyless verification of the run image requires the public key of the transparency log")
+		}
+
+		roots, err := loadCertificatePool(config.TrustRootPath)
+		if err != nil {
+			return "", err
+		}
+		rekorKey, err := loadPublicKey(config.RekorPublicKeyPath)
+		if err != nil {
+			return "", err
+		}
+		verifier = func(signature ImageSignature) error {
+			return verifyKeylessSignature(signature, roots, rekorKey, config)
+		}
+	} else {
+		publicKey, err := loadPublicKey(config.PublicKeyPath)
+		if err != nil {
+			return "", err
+		}
+		verifier = func(signature ImageSignature) error {
+			return verifySignature(publicKey, signature.Payload, signature.Signature)
+		}
+	}
+
+	digest, err := source.Digest(reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of run image %s: %w", reference, err)
+	}
+
+	signatures, err := source.Signatures(reference, digest)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch signatures of run image %s@%s: %w", reference, digest, err)
+	}
+
+	var failures []string
+	for _, signature := range signatures {
+		if err := verifyPayload(signature.Payload, reference, digest); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+
+		if err := verifier(signature); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+
+		return digest, nil
+	}
+
+	return "", fmt.Errorf("no valid signature found for run image %s@%s: %s", reference, digest, strings.Join(failures, "; "))
+}
+
+func verifyPayload(payload []byte, reference ImageReference, digest string) error {
+	var simpleSigning simpleSigningPayload
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return fmt.Errorf("failed to parse signature payload: %w", err)
+	}
+
+	if simpleSigning.Critical.Type != cosignSignatureType {
+		return fmt.Errorf("unexpected signature payload type '%s'", simpleSigning.Critical.Type)
+	}
+
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signature payload is for digest %s", simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+
+	signedReference, err := ParseImageReference(simpleSigning.Critical.Identity.DockerReference)
+	if err != nil || signedReference.Registry != reference.Registry || signedReference.Repository != reference.Repository {
+		return fmt.Errorf("signature payload is for image '%s'", simpleSigning.Critical.Identity.DockerReference)
+	}
+
+	return nil
+}
+
+func verifyKeylessSignature(signature ImageSignature, roots *x509.CertPool, rekorKey crypto.PublicKey, config SignatureVerificationConfig) error {
+	if len(signature.Certificate) == 0 {
+		return errors.New("signature has no certificate for keyless verification")
+	}
+
+	certificate, err := parseCertificate(signature.Certificate)
+	if err != nil {
+		return err
+	}
+
+	signedAt, err := verifyTransparencyLogEntry(signature, certificate, rekorKey)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(signature.Chain)
+
+	// Signing certificates are short lived, so the chain is checked at the
+	// time the transparency log recorded the signature rather than at build
+	// time.
+	_, err = certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return fmt.Errorf("signing certificate is not trusted: %w", err)
+	}
+
+	identities := certificate.EmailAddresses
+	for _, uri := range certificate.URIs {
+		identities = append(identities, uri.String())
+	}
+	if !slices.Contains(identities, config.CertificateIdentity) {
+		return fmt.Errorf("signing certificate identities %v do not match '%s'", identities, config.CertificateIdentity)
+	}
+
+	if issuer := certificateIssuer(certificate); issuer != config.CertificateOIDCIssuer {
+		return fmt.Errorf("signing certificate issuer '%s' does not match '%s'", issuer, config.CertificateOIDCIssuer)
+	}
+
+	return verifySignature(certificate.PublicKey, signature.Payload, signature.Signature)
+}
+
+// verifyTransparencyLogEntry checks that the Rekor bundle of the signature
+// is signed by the transparency log and records this signature and
+// certificate, and returns the time the log integrated it.
+func verifyTransparencyLogEntry(signature ImageSignature, certificate *x509.Certificate, rekorKey crypto.PublicKey) (time.Time, error) {
+	if len(signature.Bundle) == 0 {
+		return time.Time{}, errors.New("signature has no transparency log entry to tell when it was made")
+	}
+
+	var bundle rekorBundle
+	if err := json.Unmarshal(signature.Bundle, &bundle); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKIXPublicKey(rekorKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if logID := sha256.Sum256(keyDER); bundle.Payload.LogID != hex.EncodeToString(logID[:]) {
+		return time.Time{}, fmt.Errorf("transparency log entry is from another log '%s'", bundle.Payload.LogID)
+	}
+
+	canonicalPayload, err := json.Marshal(bundle.Payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySignature(rekorKey, canonicalPayload, bundle.SignedEntryTimestamp); err != nil {
+		return time.Time{}, fmt.Errorf("transparency log entry is not signed by the log: %w", err)
+	}
+
+	body, err := decodeBase64(bundle.Payload.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode transparency log entry: %w", err)
+	}
+
+	var entry hashedRekordEntry
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(signature.Payload)
+	if entry.Kind != "hashedrekord" || entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(payloadHash[:]) {
+		return time.Time{}, errors.New("transparency log entry is for another payload")
+	}
+	if !bytes.Equal(entry.Spec.Signature.Content, signature.Signature) {
+		return time.Time{}, errors.New("transparency log entry is for another signature")
+	}
+	if loggedCertificate, err := parseCertificate(entry.Spec.Signature.PublicKey.Content); err != nil || !loggedCertificate.Equal(certificate) {
+		return time.Time{}, errors.New("transparency log entry is for another certificate")
+	}
+
+	return time.Unix(bundle.Payload.IntegratedTime, 0), nil
+}
+
+func verifySignature(publicKey crypto.PublicKey, payload, signature []byte) error {
+	digest := sha256.Sum256(payload)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("invalid ECDSA signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid RSA signature: %w", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, signature) {
+			return errors.New("invalid Ed25519 signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return nil
+}
+
+func certificateIssuer(certificate *x509.Certificate) string {
+	for _, extension := range certificate.Extensions {
+		switch {
+		case extension.Id.Equal(fulcioIssuerV2OID):
+			var issuer string
+			if _, err := asn1.Unmarshal(extension.Value, &issuer); err == nil {
+				return issuer
+			}
+		case extension.Id.Equal(fulcioIssuerOID):
+			return string(extension.Value)
+		}
+	}
+	return ""
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run image public key: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("run image public key %s is not PEM encoded", path)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse run image public key %s: %w", path, err)
+	}
+
+	return publicKey, nil
+}
+
+func loadCertificatePool(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run image trust root: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("run image trust root %s does not contain any certificates", path)
+	}
+
+	return pool, nil
+}
+
+func parseCertificate(content []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func decodeBase64(value string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+}
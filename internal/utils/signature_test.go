@@ -0,0 +1,351 @@
+package utils_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testVerifyRunImageSignature(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+
+		layout        *testhelpers.OCILayout
+		key           *ecdsa.PrivateKey
+		publicKeyPath string
+		digest        string
+		reference     utils.ImageReference
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir := t.TempDir()
+
+		layout, err = testhelpers.NewOCILayout(filepath.Join(tmpDir, "layout"))
+		Expect(err).NotTo(HaveOccurred())
+
+		publicKeyPath = filepath.Join(tmpDir, "cosign.pub")
+		key, err = testhelpers.GenerateSigningKey(publicKeyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest, err = layout.AddImage("paketobuildpacks/run-nodejs-18-ubi8-base:latest", map[string]interface{}{})
+		Expect(err).NotTo(HaveOccurred())
+
+		reference, err = utils.ParseImageReference("paketobuildpacks/run-nodejs-18-ubi8-base")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	context("when the signature was made with the trusted public key", func() {
+		it.Before(func() {
+			Expect(layout.AddSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, key, nil)).To(Succeed())
+		})
+
+		it("returns the verified digest from an OCI layout", func() {
+			verifiedDigest, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifiedDigest).To(Equal(digest))
+		})
+
+		it("returns the verified digest from a registry", func() {
+			server := httptest.NewServer(registryHandler(layout.Path))
+			defer server.Close()
+
+			verifiedDigest, err := utils.VerifyRunImageSignature(utils.RegistrySource{BaseURL: server.URL}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifiedDigest).To(Equal(digest))
+		})
+
+		it("fails when the reference pins a different digest", func() {
+			otherDigest, err := layout.AddImage("paketobuildpacks/run-nodejs-18-ubi8-base:other", map[string]interface{}{"architecture": "arm64"})
+			Expect(err).NotTo(HaveOccurred())
+
+			pinnedReference, err := utils.ParseImageReference("paketobuildpacks/run-nodejs-18-ubi8-base@" + otherDigest)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, pinnedReference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to fetch signatures of run image")))
+		})
+	})
+
+	context("when the signature was made with another key", func() {
+		it("fails", func() {
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layout.AddSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, otherKey, nil)).To(Succeed())
+
+			_, err = utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("no valid signature found for run image paketobuildpacks/run-nodejs-18-ubi8-base:latest@" + digest)))
+			Expect(err).To(MatchError(ContainSubstring("invalid ECDSA signature")))
+		})
+	})
+
+	context("when the signature payload is for another digest", func() {
+		it("fails", func() {
+			otherDigest := "sha256:" + strings.Repeat("b", 64)
+			Expect(layout.AddSignatureWithPayloadDigest("paketobuildpacks/run-nodejs-18-ubi8-base", digest, otherDigest, key, nil)).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("signature payload is for digest " + otherDigest)))
+		})
+	})
+
+	context("when there is no signature", func() {
+		it("fails", func() {
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("not found in OCI layout")))
+		})
+	})
+
+	context("when the public key can not be read", func() {
+		it("fails", func() {
+			Expect(layout.AddSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, key, nil)).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: "/does/not/exist",
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to read run image public key")))
+		})
+	})
+
+	context("when the signature payload is for another image", func() {
+		it("fails", func() {
+			Expect(layout.AddSignatureForReference("paketobuildpacks/run-nodejs-18-ubi8-base", "index.docker.io/attacker/run-image", digest, key)).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("signature payload is for image 'index.docker.io/attacker/run-image'")))
+		})
+
+		it("accepts the fully qualified name of the run image", func() {
+			Expect(layout.AddSignatureForReference("paketobuildpacks/run-nodejs-18-ubi8-base", "index.docker.io/paketobuildpacks/run-nodejs-18-ubi8-base", digest, key)).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	context("when the registry announces another digest", func() {
+		it("fails", func() {
+			Expect(layout.AddSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, key, nil)).To(Succeed())
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				recorder := httptest.NewRecorder()
+				registryHandler(layout.Path).ServeHTTP(recorder, r)
+				for name, values := range recorder.Header() {
+					w.Header()[name] = values
+				}
+				if strings.Contains(r.URL.Path, "/manifests/latest") {
+					w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("d", 64))
+				}
+				w.WriteHeader(recorder.Code)
+				_, _ = w.Write(recorder.Body.Bytes())
+			}))
+			defer server.Close()
+
+			_, err := utils.VerifyRunImageSignature(utils.RegistrySource{BaseURL: server.URL}, reference, utils.SignatureVerificationConfig{
+				PublicKeyPath: publicKeyPath,
+			})
+			Expect(err).To(MatchError(ContainSubstring("registry announced digest sha256:dddd")))
+		})
+	})
+
+	context("keyless verification", func() {
+		var (
+			trustRootPath string
+			rekorKeyPath  string
+			rekorKey      *ecdsa.PrivateKey
+			signingKey    *ecdsa.PrivateKey
+			certificate   string
+			signedAt      time.Time
+			config        utils.SignatureVerificationConfig
+		)
+
+		it.Before(func() {
+			var err error
+			caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			caTemplate := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "test-root"},
+				NotBefore:             time.Now().Add(-48 * time.Hour),
+				NotAfter:              time.Now().Add(-24 * time.Hour),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+				KeyUsage:              x509.KeyUsageCertSign,
+			}
+			caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			trustRootPath = filepath.Join(t.TempDir(), "roots.pem")
+			Expect(os.WriteFile(trustRootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644)).To(Succeed())
+
+			rekorKeyPath = filepath.Join(t.TempDir(), "rekor.pub")
+			rekorKey, err = testhelpers.GenerateSigningKey(rekorKeyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			issuer, err := asn1UTF8String("https://issuer.example.com")
+			Expect(err).NotTo(HaveOccurred())
+
+			// The signing certificate expired long ago, as they do in
+			// practice, but was valid when the log recorded the signature.
+			leafTemplate := &x509.Certificate{
+				SerialNumber:   big.NewInt(2),
+				NotBefore:      time.Now().Add(-47 * time.Hour),
+				NotAfter:       time.Now().Add(-46 * time.Hour),
+				KeyUsage:       x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+				EmailAddresses: []string{"release@example.com"},
+				URIs:           []*url.URL{},
+				ExtraExtensions: []pkix.Extension{
+					{Id: []int{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuer},
+				},
+			}
+			leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, &signingKey.PublicKey, caKey)
+			Expect(err).NotTo(HaveOccurred())
+			certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}))
+			signedAt = time.Now().Add(-46*time.Hour - 30*time.Minute)
+
+			config = utils.SignatureVerificationConfig{
+				TrustRootPath:         trustRootPath,
+				CertificateIdentity:   "release@example.com",
+				CertificateOIDCIssuer: "https://issuer.example.com",
+				RekorPublicKeyPath:    rekorKeyPath,
+			}
+		})
+
+		it("verifies the log entry, the certificate chain and identity", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, signedAt)).To(Succeed())
+
+			verifiedDigest, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifiedDigest).To(Equal(digest))
+		})
+
+		it("requires the certificate identity and issuer", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, signedAt)).To(Succeed())
+
+			config.CertificateOIDCIssuer = ""
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError("keyless verification of the run image requires a certificate identity and OIDC issuer"))
+
+			config.CertificateOIDCIssuer = "https://issuer.example.com"
+			config.CertificateIdentity = ""
+			_, err = utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError("keyless verification of the run image requires a certificate identity and OIDC issuer"))
+		})
+
+		it("requires the public key of the transparency log", func() {
+			config.RekorPublicKeyPath = ""
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError("keyless verification of the run image requires the public key of the transparency log"))
+		})
+
+		it("fails when the identity does not match", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, signedAt)).To(Succeed())
+
+			config.CertificateIdentity = "someone-else@example.com"
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("do not match 'someone-else@example.com'")))
+		})
+
+		it("fails when the issuer does not match", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, signedAt)).To(Succeed())
+
+			config.CertificateOIDCIssuer = "https://other.example.com"
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("does not match 'https://other.example.com'")))
+		})
+
+		it("fails without a transparency log entry", func() {
+			Expect(layout.AddSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, map[string]string{
+				"dev.sigstore.cosign/certificate": certificate,
+			})).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("signature has no transparency log entry to tell when it was made")))
+		})
+
+		it("fails when the log entry is signed by another log", func() {
+			otherLogKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, otherLogKey, signedAt)).To(Succeed())
+
+			_, err = utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("transparency log entry is from another log")))
+		})
+
+		it("fails when the log recorded the signature after the certificate expired", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, time.Now())).To(Succeed())
+
+			_, err := utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("signing certificate is not trusted")))
+		})
+
+		it("fails when the certificate does not chain to the trust root", func() {
+			Expect(layout.AddKeylessSignature("paketobuildpacks/run-nodejs-18-ubi8-base", digest, signingKey, certificate, rekorKey, signedAt)).To(Succeed())
+
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			otherTemplate := &x509.Certificate{
+				SerialNumber:          big.NewInt(3),
+				Subject:               pkix.Name{CommonName: "other-root"},
+				NotBefore:             time.Now().Add(-48 * time.Hour),
+				NotAfter:              time.Now().Add(24 * time.Hour),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+				KeyUsage:              x509.KeyUsageCertSign,
+			}
+			otherDER, err := x509.CreateCertificate(rand.Reader, otherTemplate, otherTemplate, &otherKey.PublicKey, otherKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			config.TrustRootPath = filepath.Join(t.TempDir(), "other-roots.pem")
+			Expect(os.WriteFile(config.TrustRootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherDER}), 0644)).To(Succeed())
+
+			_, err = utils.VerifyRunImageSignature(utils.OCILayoutSource{Path: layout.Path}, reference, config)
+			Expect(err).To(MatchError(ContainSubstring("signing certificate is not trusted")))
+		})
+	})
+}
+
+func asn1UTF8String(value string) ([]byte, error) {
+	return asn1.MarshalWithParams(value, "utf8")
+}
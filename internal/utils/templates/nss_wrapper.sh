@@ -0,0 +1,14 @@
+#!/usr/bin/env bash
+# nss_wrapper.sh is sourced by bash through BASH_ENV. When the container runs
+# with a user ID that is not in /etc/passwd, as OpenShift does, it adds an
+# entry for that user to the passwd file of nss_wrapper, with the home of the
+# CNB user, so that whoami and the other lookups of the user work. HOME is
+# set by the image itself, so that npm works for processes that are not
+# started by bash as well.
+# The home is filled in by the extension.
+nss_wrapper_uid="$(id -u)"
+if ! grep -q "^[^:]*:[^:]*:${nss_wrapper_uid}:" /etc/passwd &&
+  ! grep -q "^[^:]*:[^:]*:${nss_wrapper_uid}:" "${NSS_WRAPPER_PASSWD}"; then
+  echo "default:x:${nss_wrapper_uid}:0:Default user:@HOME@:/bin/bash" >> "${NSS_WRAPPER_PASSWD}" 2> /dev/null
+fi
+unset nss_wrapper_uid
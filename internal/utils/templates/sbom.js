@@ -0,0 +1,136 @@
+// sbom.js writes the CycloneDX and SPDX documents of the RPMs installed by
+// the extension, together with the Node.js runtime it runs with.
+//
+//   node sbom.js installed-since <rpm list> <directory> <metadata>
+//
+// installed-since lists the packages that are not in the rpm list, which
+// holds the NEVRA of the packages installed before. The metadata is the
+// base64 encoded JSON of the Node.js dependency and the distro of the
+// packages.
+//
+// The documents are reproducible: their serial number is derived from the
+// hash of what they list, and they are created at SOURCE_DATE_EPOCH, or at
+// the fixed time the lifecycle gives to the files of the images it builds.
+"use strict";
+
+const { spawnSync } = require("child_process");
+const crypto = require("crypto");
+const fs = require("fs");
+const path = require("path");
+
+const [mode, list, directory, encodedMetadata] = process.argv.slice(2);
+const metadata = JSON.parse(Buffer.from(encodedMetadata, "base64").toString());
+
+const queryFormat = "%{NAME}\\t%|EPOCH?{%{EPOCH}}|\\t%{VERSION}\\t%{RELEASE}\\t%{ARCH}\\n";
+
+function rpm(args) {
+  const result = spawnSync("rpm", args, { encoding: "utf8", maxBuffer: 64 * 1024 * 1024 });
+  if (result.error) {
+    throw result.error;
+  }
+  if (result.status !== 0) {
+    throw new Error(`rpm ${args.join(" ")} failed: ${result.stderr}`);
+  }
+  return result.stdout.split("\n").filter((line) => line !== "");
+}
+
+function lines(file) {
+  return fs.readFileSync(file, "utf8").split("\n").filter((line) => line !== "");
+}
+
+let packages;
+switch (mode) {
+  case "installed-since": {
+    const before = new Set(lines(list));
+    const installed = rpm(["-qa", "--qf", "%{NEVRA}\\n"])
+      .filter((nevra) => !before.has(nevra) && !nevra.startsWith("gpg-pubkey-"));
+    packages = installed.length > 0 ? rpm(["-q", "--qf", queryFormat, ...installed]) : [];
+    break;
+  }
+  default:
+    throw new Error(`unknown mode '${mode}', expected 'installed-since'`);
+}
+
+const components = [...new Set(packages)].sort().map((line) => {
+  const [name, epoch, version, release, arch] = line.split("\t");
+  const qualifiers = [`arch=${arch}`].concat(epoch ? [`epoch=${epoch}`] : []);
+  return {
+    type: "library",
+    name: name,
+    version: `${epoch ? `${epoch}:` : ""}${version}-${release}`,
+    purl: `pkg:rpm/${metadata.distro}/${encodeURIComponent(name)}@${version}-${release}?${qualifiers.join("&")}`,
+  };
+});
+
+// The version of the dependency only identifies the selected major version,
+// the exact one is the version of the installed runtime.
+const node = {
+  type: "application",
+  name: metadata.name,
+  version: process.versions.node,
+  purl: metadata.purl || `pkg:generic/${metadata.name}@${process.versions.node}`,
+  cpe: metadata.cpe,
+  licenses: metadata.licenses || [],
+};
+
+const all = [node, ...components];
+
+// A name-based UUID, with the version and variant bits of UUIDv5, of the
+// hash of the inputs.
+const hash = crypto.createHash("sha256").update(JSON.stringify([metadata, all])).digest();
+hash[6] = (hash[6] & 0x0f) | 0x50;
+hash[8] = (hash[8] & 0x3f) | 0x80;
+const hex = hash.subarray(0, 16).toString("hex");
+const uuid = `${hex.slice(0, 8)}-${hex.slice(8, 12)}-${hex.slice(12, 16)}-${hex.slice(16, 20)}-${hex.slice(20)}`;
+
+const created = (process.env.SOURCE_DATE_EPOCH ? new Date(Number(process.env.SOURCE_DATE_EPOCH) * 1000) : new Date("1980-01-01T00:00:01Z"))
+  .toISOString().replace(/\.\d+Z$/, "Z");
+
+const cyclonedx = {
+  bomFormat: "CycloneDX",
+  specVersion: "1.5",
+  serialNumber: `urn:uuid:${uuid}`,
+  version: 1,
+  metadata: {
+    timestamp: created,
+    tools: { components: [{ type: "application", name: "ubi-nodejs-extension" }] },
+  },
+  components: all.map((component) => ({
+    type: component.type,
+    "bom-ref": component.purl,
+    name: component.name,
+    version: component.version,
+    purl: component.purl,
+    ...(component.cpe ? { cpe: component.cpe } : {}),
+    ...(component.licenses && component.licenses.length > 0
+      ? { licenses: component.licenses.map((license) => ({ license: { id: license } })) }
+      : {}),
+  })),
+};
+
+const spdx = {
+  spdxVersion: "SPDX-2.3",
+  dataLicense: "CC0-1.0",
+  SPDXID: "SPDXRef-DOCUMENT",
+  name: "ubi-nodejs-extension",
+  documentNamespace: `https://paketo.io/spdx/ubi-nodejs-extension/${uuid}`,
+  creationInfo: { created: created, creators: ["Tool: ubi-nodejs-extension"] },
+  documentDescribes: all.map((_, index) => `SPDXRef-Package-${index}`),
+  packages: all.map((component, index) => ({
+    SPDXID: `SPDXRef-Package-${index}`,
+    name: component.name,
+    versionInfo: component.version,
+    downloadLocation: "NOASSERTION",
+    filesAnalyzed: false,
+    licenseConcluded: "NOASSERTION",
+    licenseDeclared: component.licenses && component.licenses.length > 0 ? component.licenses.join(" AND ") : "NOASSERTION",
+    copyrightText: "NOASSERTION",
+    externalRefs: [
+      { referenceCategory: "PACKAGE-MANAGER", referenceType: "purl", referenceLocator: component.purl },
+    ].concat(component.cpe ? [{ referenceCategory: "SECURITY", referenceType: "cpe23Type", referenceLocator: component.cpe }] : []),
+  })),
+};
+
+fs.mkdirSync(directory, { recursive: true });
+fs.writeFileSync(path.join(directory, "bom.cdx.json"), `${JSON.stringify(cyclonedx, null, 2)}\n`);
+fs.writeFileSync(path.join(directory, "bom.spdx.json"), `${JSON.stringify(spdx, null, 2)}\n`);
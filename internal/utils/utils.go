@@ -1,33 +1,27 @@
 package utils
 
 import (
-	_ "embed"
-
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"text/template"
 
-	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/dockerfile"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 
 	"github.com/BurntSushi/toml"
 )
 
-//go:embed templates/build.Dockerfile
-var buildDockerfileTemplate string
-
-//go:embed templates/run.Dockerfile
-var runDockerfileTemplate string
-
 type StackImages struct {
-	Name              string `json:"name"`
-	IsDefaultRunImage bool   `json:"is_default_run_image,omitempty"`
+	Name              string   `json:"name"`
+	IsDefaultRunImage bool     `json:"is_default_run_image,omitempty"`
+	Platforms         []string `json:"platforms,omitempty"`
 	NodeVersion       string
 }
 
@@ -35,7 +29,9 @@ type ImagesJson struct {
 	StackImages []StackImages `json:"images"`
 }
 
-func GenerateConfigTomlContentFromImagesJson(imagesJsonPath string, stackId string) ([]byte, error) {
+// GenerateConfigTomlContentFromImagesJson returns the config.toml content
+// listing the run images of stackId that are available for arch.
+func GenerateConfigTomlContentFromImagesJson(imagesJsonPath string, stackId string, arch string) ([]byte, error) {
 	imagesJsonData, err := ParseImagesJsonFile(imagesJsonPath)
 	if err != nil {
 		return []byte{}, err
@@ -51,7 +47,7 @@ func GenerateConfigTomlContentFromImagesJson(imagesJsonPath string, stackId stri
 		return []byte{}, err
 	}
 
-	configTomlContent, err := CreateConfigTomlFileContent(defaultNodeVersion, nodejsStacks, stackId)
+	configTomlContent, err := CreateConfigTomlFileContent(defaultNodeVersion, FilterStackImagesByArch(nodejsStacks, arch), stackId)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -83,15 +79,17 @@ func CreateConfigTomlFileContent(defaultNodeVersion string, nodejsStacks []Stack
 		return bytes.Buffer{}, err
 	}
 
+	profile, err := GetDistroProfile(stackId)
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+
 	var dependencies []map[string]interface{}
 
 	for _, stack := range nodejsStacks {
-		var source string
-		if stackId == "io.buildpacks.stacks.ubi8" || stackId == "io.buildpacks.stacks.ubi9" {
-			source = fmt.Sprintf("paketobuildpacks/run-nodejs-%s-%s-base", stack.NodeVersion, osCodename)
-		} else {
-			osCodenameVersion := strings.Split(osCodename, "ubi")[1]
-			source = fmt.Sprintf("paketobuildpacks/ubi-%s-run-nodejs-%s-base", osCodenameVersion, stack.NodeVersion)
+		source, err := profile.GetRunImage(stack.NodeVersion, osCodename)
+		if err != nil {
+			return bytes.Buffer{}, err
 		}
 		dependency := map[string]interface{}{
 			"id":      "node",
@@ -119,6 +117,19 @@ func CreateConfigTomlFileContent(defaultNodeVersion string, nodejsStacks []Stack
 	return *buf, nil
 }
 
+// FilterStackImagesByArch returns the stacks whose run images are published
+// for linux/<arch>. Stacks without platforms are assumed to be published for
+// all of them.
+func FilterStackImagesByArch(stacks []StackImages, arch string) []StackImages {
+	var filteredStacks []StackImages
+	for _, stack := range stacks {
+		if len(stack.Platforms) == 0 || slices.Contains(stack.Platforms, "linux/"+arch) {
+			filteredStacks = append(filteredStacks, stack)
+		}
+	}
+	return filteredStacks
+}
+
 func GetNodejsStackImages(imagesJsonData ImagesJson) ([]StackImages, error) {
 
 	// Filter out the nodejs stacks based on the stack name
@@ -167,48 +178,31 @@ func ParseImagesJsonFile(imagesJsonPath string) (ImagesJson, error) {
 	return imagesJsonData, nil
 }
 
-func GetDuringBuildPermissions(filepath string) structs.DuringBuildPermissions {
-
-	defaultPermissions := structs.DuringBuildPermissions{
-		CNB_USER_ID:  constants.DEFAULT_USER_ID,
-		CNB_GROUP_ID: constants.DEFAULT_GROUP_ID,
-	}
-	re := regexp.MustCompile(`cnb:x:(\d+):(\d+)::`)
-
-	etcPasswdFile, err := os.ReadFile(filepath)
-
-	if err != nil {
-		return defaultPermissions
-	}
-	etcPasswdContent := string(etcPasswdFile)
-
-	matches := re.FindStringSubmatch(etcPasswdContent)
-
-	if len(matches) != 3 {
-		return defaultPermissions
-	}
-
-	CNB_USER_ID, err := strconv.Atoi(matches[1])
-
-	if err != nil {
-		return defaultPermissions
-	}
+// GenerateBuildDockerfile returns the build.Dockerfile, labeled with the hash
+// of its instructions. As these only depend on the inputs of the build, the
+// label can be used to reuse a cached build image. The provenance labels and
+// the subscription files, which change without changing what is installed,
+// are left out of the hash.
+func GenerateBuildDockerfile(buildProps structs.BuildDockerfileProps) (result string, Error error) {
 
-	CNB_GROUP_ID, err := strconv.Atoi(matches[2])
+	buildProps.PACKAGE_MANAGER = withDefaultPackageManager(buildProps.PACKAGE_MANAGER)
+	labels, rhsm, rhsmRepository := buildProps.LABELS, buildProps.RHSM, buildProps.RHSM_REPOSITORY
+	buildProps.INPUTS_HASH = ""
+	buildProps.LABELS = nil
+	buildProps.RHSM = nil
+	buildProps.RHSM_REPOSITORY = structs.File{}
 
+	instructions, err := renderDockerfile(buildDockerfile(buildProps))
 	if err != nil {
-		return defaultPermissions
+		return "", err
 	}
 
-	return structs.DuringBuildPermissions{
-		CNB_USER_ID:  CNB_USER_ID,
-		CNB_GROUP_ID: CNB_GROUP_ID,
-	}
-}
+	buildProps.INPUTS_HASH = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(instructions)))
+	buildProps.LABELS = labels
+	buildProps.RHSM = rhsm
+	buildProps.RHSM_REPOSITORY = rhsmRepository
 
-func GenerateBuildDockerfile(buildProps structs.BuildDockerfileProps) (result string, Error error) {
-
-	result, err := fillPropsToTemplate(buildProps, buildDockerfileTemplate)
+	result, err = renderDockerfile(buildDockerfile(buildProps))
 
 	if err != nil {
 		return "", err
@@ -219,7 +213,9 @@ func GenerateBuildDockerfile(buildProps structs.BuildDockerfileProps) (result st
 
 func GenerateRunDockerfile(runProps structs.RunDockerfileProps) (result string, Error error) {
 
-	result, err := fillPropsToTemplate(runProps, runDockerfileTemplate)
+	runProps.PACKAGE_MANAGER = withDefaultPackageManager(runProps.PACKAGE_MANAGER)
+
+	result, err := renderDockerfile(runDockerfile(runProps))
 
 	if err != nil {
 		return "", err
@@ -227,71 +223,11 @@ func GenerateRunDockerfile(runProps structs.RunDockerfileProps) (result string,
 	return result, nil
 }
 
-func fillPropsToTemplate(properties any, templateString string) (result string, Error error) {
-
-	templ, err := template.New("template").Parse(templateString)
+func renderDockerfile(file dockerfile.Dockerfile, err error) (string, error) {
 	if err != nil {
 		return "", err
 	}
-
-	var buf bytes.Buffer
-	err = templ.Execute(&buf, properties)
-	if err != nil {
-		panic(err)
-	}
-
-	return buf.String(), nil
-}
-
-func GetSymlinks(imageId string, nodeVersion int) string {
-	if imageId == "io.buildpacks.stacks.ubi8" && (nodeVersion == 24 || nodeVersion == 22) {
-		return `ln -sf /opt/rh/gcc-toolset-13/root/usr/bin/gcc /usr/bin/gcc && \
-    ln -sf /opt/rh/gcc-toolset-13/root/usr/bin/g++ /usr/bin/g++`
-	} else if imageId == "io.buildpacks.stacks.ubi10" && (nodeVersion == 24) {
-		return `ln -s /usr/bin/node-24 /usr/bin/node && \
-ln -s /usr/bin/npm-24 /usr/bin/npm && \
-ln -s /usr/bin/npx-24 /usr/bin/npx`
-	} else if imageId == "io.buildpacks.stacks.ubi10" && (nodeVersion == 22) {
-		return `rm /usr/bin/node && ln -s /usr/bin/node-22 /usr/bin/node && \
-rm /usr/bin/npm && ln -s /usr/bin/npm-22 /usr/bin/npm && \
-rm /usr/bin/npx && ln -s /usr/bin/npx-22 /usr/bin/npx`
-	}
-	return ""
-}
-
-func GetBuildPackages(imageId string, nodeVersion int) (string, error) {
-
-	switch imageId {
-	case "io.buildpacks.stacks.ubi8":
-		switch nodeVersion {
-		case 16, 18, 20:
-			return "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3", nil
-		case 22:
-			return "make gcc-toolset-13-gcc gcc-toolset-13-gcc-c++ gcc-toolset-13-runtime libatomic_ops git openssl-devel python3.12 nodejs npm nodejs-nodemon nss_wrapper-libs which", nil
-		case 24:
-			return "make gcc-toolset-13-gcc gcc-toolset-13-gcc-c++ gcc-toolset-13-runtime libatomic_ops git openssl-devel python3.12 nodejs npm nodejs-nodemon nss_wrapper-libs which", nil
-		default:
-			return "", fmt.Errorf("unsupported Node.js version %d for image %s", nodeVersion, imageId)
-		}
-	case "io.buildpacks.stacks.ubi9":
-		switch nodeVersion {
-		case 18, 20, 22, 24:
-			return "make gcc gcc-c++ git openssl-devel nodejs npm nodejs-nodemon nss_wrapper-libs python3", nil
-		default:
-			return "", fmt.Errorf("unsupported Node.js version %d for image %s", nodeVersion, imageId)
-		}
-	case "io.buildpacks.stacks.ubi10":
-		switch nodeVersion {
-		case 22:
-			return "make gcc gcc-c++ git openssl-devel nodejs nodejs-nodemon nodejs-npm nss_wrapper-libs python3", nil
-		case 24:
-			return "make gcc gcc-c++ git openssl-devel nodejs24 nodejs-nodemon nodejs24-npm nss_wrapper-libs python3", nil
-		default:
-			return "", fmt.Errorf("unsupported Node.js version %d for image %s", nodeVersion, imageId)
-		}
-	}
-
-	return "", fmt.Errorf("unsupported image ID: %s", imageId)
+	return file.Render()
 }
 
 func GetOsCodenameFromStackId(stackId string) (string, error) {
@@ -309,14 +245,3 @@ func GetOsCodenameFromStackId(stackId string) (string, error) {
 
 	return osCodename, nil
 }
-
-func ShouldEnableNodejsModule(stackId string) bool {
-	switch stackId {
-	case "io.buildpacks.stacks.ubi8", "io.buildpacks.stacks.ubi9":
-		return true
-	case "io.buildpacks.stacks.ubi10":
-		return false
-	default:
-		return true
-	}
-}
@@ -2,12 +2,14 @@ package utils_test
 
 import (
 	_ "embed"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
-	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	testhelpers "github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
@@ -37,7 +39,7 @@ func testGenerateConfigTomlContentFromImagesJson(t *testing.T, context spec.G, i
 			imagesJsonPath := filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubi9")
+			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubi9", "amd64")
 
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(configTomlContent)).To(ContainSubstring(`[metadata]
@@ -64,11 +66,35 @@ func testGenerateConfigTomlContentFromImagesJson(t *testing.T, context spec.G, i
 		})
 	})
 
+	context("When the images.json file lists the platforms of the run images", func() {
+
+		it("only includes the run images published for the architecture", func() {
+			imagesJsonPath := filepath.Join(t.TempDir(), "images.json")
+			Expect(os.WriteFile(imagesJsonPath, []byte(`{
+  "images": [
+    {"name": "nodejs-18", "platforms": ["linux/amd64", "linux/arm64", "linux/s390x", "linux/ppc64le"]},
+    {"name": "nodejs-20", "is_default_run_image": true, "platforms": ["linux/amd64", "linux/arm64"]},
+    {"name": "nodejs-22"}
+  ]
+}`), 0644)).To(Succeed())
+
+			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubi9", "s390x")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configTomlContent)).To(ContainSubstring("paketobuildpacks/run-nodejs-18-ubi9-base"))
+			Expect(string(configTomlContent)).NotTo(ContainSubstring("paketobuildpacks/run-nodejs-20-ubi9-base"))
+			Expect(string(configTomlContent)).To(ContainSubstring("paketobuildpacks/run-nodejs-22-ubi9-base"))
+
+			configTomlContent, err = utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubi9", "arm64")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configTomlContent)).To(ContainSubstring("paketobuildpacks/run-nodejs-20-ubi9-base"))
+		})
+	})
+
 	context("When GenerateConfigTomlContentFromImagesJson is being called with an invalide images.json file ", func() {
 
 		it("It should throw an error with a message", func() {
 
-			_, err := utils.GenerateConfigTomlContentFromImagesJson("/path/to/invalid/images.json", "io.buildpacks.stacks.ubix")
+			_, err := utils.GenerateConfigTomlContentFromImagesJson("/path/to/invalid/images.json", "io.buildpacks.stacks.ubix", "amd64")
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("no such file or directory"))
@@ -404,16 +430,15 @@ func testGenerateBuildDockerfile(t *testing.T, context spec.G, it spec.S) {
 
 		it("Should fill with properties the template/build.Dockerfile", func() {
 
-			getInstalledPackages, err := utils.GetBuildPackages("io.buildpacks.stacks.ubi8", 16)
+			nodeProfile, err := utils.GetNodeProfile("io.buildpacks.stacks.ubi8", "amd64", 16)
 			Expect(err).NotTo(HaveOccurred())
 
 			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
 				NODEJS_VERSION:       16,
 				CNB_USER_ID:          1000,
 				CNB_GROUP_ID:         1000,
-				CNB_STACK_ID:         "io.buildpacks.stacks.ubi8",
-				PACKAGES:             getInstalledPackages,
-				ENABLE_NODEJS_MODULE: utils.ShouldEnableNodejsModule("io.buildpacks.stacks.ubi8"),
+				PACKAGES:             nodeProfile.GetBuildPackages(),
+				ENABLE_NODEJS_MODULE: true,
 			})
 
 			Expect(err).NotTo(HaveOccurred())
@@ -422,21 +447,564 @@ FROM ${base_image}
 
 USER root
 
-ARG build_id=0
-RUN echo ${build_id}
-
 RUN microdnf -y module enable nodejs:16 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
     install -y make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3 && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
     microdnf clean all
 
-RUN echo uid:gid "1000:1000"
-USER 1000:1000
-
-RUN echo "CNB_STACK_ID: io.buildpacks.stacks.ubi8"`
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:e09a84703d00f1d662c4421398231cffea2e8d47e1110852a6297e9daf982748" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1000:1000`
 			Expect(output).To(Equal(expectedOutput))
 
 		})
 	})
+
+	context("Enabling FIPS mode", func() {
+
+		it("Should switch the crypto policy and check that Node.js runs in FIPS mode", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+				FIPS:                 true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm crypto-policies-scripts && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    update-crypto-policies --set FIPS && \
+    microdnf clean all && \
+    (OPENSSL_FORCE_FIPS_MODE=1 NODE_OPTIONS=--enable-fips node -p "crypto.getFips()" | grep -qx 1 || \
+    (echo "FIPS mode could not be enabled for Node.js" >&2 && exit 1))
+
+ENV OPENSSL_FORCE_FIPS_MODE=1 \
+    NODE_OPTIONS=--enable-fips
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:21af7ee5787a1b63d3ee896423960f71c6a8e699b6a387bab1a098047ed93beb" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+		})
+	})
+
+	context("Adding CA certificates", func() {
+
+		it("Should add the certificates to the trust store before installing Node.js", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+				CA_CERTIFICATES: []structs.File{
+					{Name: "corporate-ca-root.pem", Content: "Um9vdA=="},
+					{Name: "corporate-ca-proxy.pem", Content: "UHJveHk="},
+				},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN mkdir -p /etc/pki/ca-trust/source/anchors && \
+    echo Um9vdA== | base64 -d > /etc/pki/ca-trust/source/anchors/corporate-ca-root.pem && \
+    echo UHJveHk= | base64 -d > /etc/pki/ca-trust/source/anchors/corporate-ca-proxy.pem && \
+    update-ca-trust && \
+    microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+
+ENV NODE_EXTRA_CA_CERTS=/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:e6a591dfb237179ad1c187f68230ef2b372eeff85bd9e1e66bb45f1327e5809c" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+		})
+	})
+
+	context("Adding custom package repositories", func() {
+
+		it("Should add the repositories and GPG keys before installing Node.js", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:               20,
+				CNB_USER_ID:                  1002,
+				CNB_GROUP_ID:                 1000,
+				PACKAGES:                     []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE:         true,
+				REPOSITORIES:                 []structs.File{{Name: "internal.repo", Content: "UmVwbw=="}},
+				GPG_KEYS:                     []structs.File{{Name: "RPM-GPG-KEY-internal", Content: "S2V5"}},
+				DISABLE_DEFAULT_REPOSITORIES: true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN mkdir -p /etc/yum.repos.d /etc/pki/rpm-gpg && \
+    mkdir -p /etc/yum.repos.d.disabled && \
+    find /etc/yum.repos.d -maxdepth 1 -name '*.repo' -exec mv {} /etc/yum.repos.d.disabled/ \; && \
+    echo S2V5 | base64 -d > /etc/pki/rpm-gpg/RPM-GPG-KEY-internal && \
+    rpm --import /etc/pki/rpm-gpg/RPM-GPG-KEY-internal && \
+    echo UmVwbw== | base64 -d > /etc/yum.repos.d/internal.repo && \
+    chmod 644 /etc/yum.repos.d/*.repo && \
+    microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:c15822f774266586b713078718eb7f08012122a539534833d007119106ab0659" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+		})
+	})
+
+	context("Passing build arguments", func() {
+
+		it("Should declare the build arguments", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm"},
+				BUILD_ARGS:     []string{"HTTPS_PROXY", "NO_PROXY"},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+ARG HTTPS_PROXY
+ARG NO_PROXY
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:1594e203d8452e5f282b2c3456fc5a32e430ae3d67027f0406b5f399a1d70846" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+		})
+	})
+
+	context("Using a Red Hat subscription", func() {
+
+		it("Should only provide the subscription while installing the packages", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+				RHSM: []structs.BindingFile{
+					{Source: "/platform/bindings/subscription/1234-key.pem", Dest: "/etc/pki/entitlement/1234-key.pem"},
+					{Source: "/platform/bindings/subscription/1234.pem", Dest: "/etc/pki/entitlement/1234.pem"},
+					{Source: "/platform/bindings/subscription/redhat-uep.pem", Dest: "/etc/rhsm/ca/redhat-uep.pem"},
+				},
+				RHSM_REPOSITORY: structs.File{Name: "redhat.repo", Content: "UmVwbw=="},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN mkdir -p /etc/pki/entitlement /etc/rhsm/ca /etc/yum.repos.d && \
+    cp -a /etc/rhsm /tmp/rhsm && \
+    cp /platform/bindings/subscription/1234-key.pem /etc/pki/entitlement/1234-key.pem && \
+    cp /platform/bindings/subscription/1234.pem /etc/pki/entitlement/1234.pem && \
+    cp /platform/bindings/subscription/redhat-uep.pem /etc/rhsm/ca/redhat-uep.pem && \
+    echo UmVwbw== | base64 -d > /etc/yum.repos.d/redhat.repo && \
+    chmod 644 /etc/yum.repos.d/redhat.repo && \
+    microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all && \
+    rm -rf /etc/pki/entitlement/* /etc/yum.repos.d/redhat.repo /etc/rhsm && \
+    mv /tmp/rhsm /etc/rhsm
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:91de46c8ba96fc52f429b2b12bd06097a49d920d96e5714a733127d98679f704" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+
+			withoutSubscription, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(withoutSubscription).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.build-inputs="sha256:91de46c8ba96fc52f429b2b12bd06097a49d920d96e5714a733127d98679f704" \`))
+		})
+	})
+
+	context("Verifying the installed Node.js", func() {
+
+		it("Should check the Node.js major version and npm once the packages are installed", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 22,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "nodejs-npm"},
+				SYMLINKS:       []structs.Symlink{{Link: "/usr/bin/node", Target: "/usr/bin/node-22", Remove: true}},
+				VERIFY:         true,
+				VERIFY_NPM:     true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs nodejs-npm && \
+    rm /usr/bin/node && ln -s /usr/bin/node-22 /usr/bin/node && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all && \
+    (node --version 2>&1 | grep -q '^v22\.' || \
+    (echo "ubi-nodejs-extension: expected Node.js 22 but node --version reports '$(node --version 2>&1)', check the module stream and symlinks of the distro profile" >&2 && exit 1)) && \
+    (npm --version > /dev/null 2>&1 || \
+    (echo "ubi-nodejs-extension: npm was installed with Node.js 22 but can not be run, check the packages and symlinks of the distro profile" >&2 && exit 1))
+
+LABEL io.paketo.ubi-nodejs.build-inputs="sha256:e4c3ed43a2e2e4bf15ecdbc19c268eac4eb657c0b0d933517b785e9dcc8317e1" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"
+USER 1002:1000`))
+		})
+
+		it("Should leave out the npm check when npm is not installed", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 22,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs"},
+				VERIFY:         true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`    microdnf clean all && \
+    (node --version 2>&1 | grep -q '^v22\.' || \`))
+			Expect(output).NotTo(ContainSubstring("npm --version"))
+		})
+	})
+
+	context("Validating the instructions", func() {
+
+		it("Should fail for a package that is not a package name", func() {
+
+			_, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm;id"},
+			})
+
+			Expect(err).To(MatchError("invalid package name 'npm;id'"))
+		})
+
+		it("Should fail for a symlink that is not an absolute path", func() {
+
+			_, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:         true,
+				NODEJS_VERSION: 20,
+				PACKAGES:       []string{"nodejs"},
+				SYMLINKS:       []structs.Symlink{{Link: "/usr/bin/node", Target: "$(id)"}},
+			})
+
+			Expect(err).To(MatchError("invalid symlink path '$(id)' in /usr/bin/node -> $(id)"))
+		})
+
+		it("Should fail to enable the module stream without a Node.js version", func() {
+
+			_, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				PACKAGES:             []string{"nodejs"},
+				ENABLE_NODEJS_MODULE: true,
+			})
+
+			Expect(err).To(MatchError("no Node.js version to enable the nodejs module stream of"))
+		})
+
+		it("Should fail for an invalid build argument", func() {
+
+			_, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm"},
+				BUILD_ARGS:     []string{"NO-PROXY"},
+			})
+
+			Expect(err).To(MatchError("invalid ARG name 'NO-PROXY'"))
+		})
+	})
+
+	context("Labeling the hash of the build inputs", func() {
+
+		var props structs.BuildDockerfileProps
+
+		it.Before(func() {
+			props = structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+			}
+		})
+
+		it("Should generate the same Dockerfile for the same inputs", func() {
+			first, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(second).To(Equal(first))
+			Expect(first).To(MatchRegexp(`\nLABEL io\.paketo\.ubi-nodejs\.build-inputs="sha256:[0-9a-f]{64}" \\\n`))
+		})
+
+		it("Should change the hash when an input changes", func() {
+			first, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			props.CNB_USER_ID = 1003
+			second, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			label := regexp.MustCompile(`build-inputs="(.*)"`)
+			Expect(label.FindStringSubmatch(second)[1]).NotTo(Equal(label.FindStringSubmatch(first)[1]))
+		})
+
+		it("Should set the environment of the CA certificates and FIPS mode in a single instruction", func() {
+			props.FIPS = true
+			props.CA_CERTIFICATES = []structs.File{{Name: "corporate-ca-root.pem", Content: "Um9vdA=="}}
+
+			output, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`
+
+ENV NODE_EXTRA_CA_CERTS=/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem \
+    OPENSSL_FORCE_FIPS_MODE=1 \
+    NODE_OPTIONS=--enable-fips
+
+LABEL`))
+			Expect(strings.Count(output, "RUN ")).To(Equal(1))
+		})
+	})
+
+	context("Labeling the build image", func() {
+
+		it("Should add the labels after the hash of the build inputs without changing it", func() {
+			props := structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm"},
+			}
+
+			unlabeled, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			props.LABELS = []structs.Label{
+				{Name: "io.paketo.ubi-nodejs.node.major-version", Value: "20"},
+				{Name: "io.paketo.ubi-nodejs.stack", Value: "io.buildpacks.stacks.ubi9"},
+			}
+			labeled, err := utils.GenerateBuildDockerfile(props)
+			Expect(err).NotTo(HaveOccurred())
+
+			label := regexp.MustCompile(`build-inputs="(.*)"`)
+			Expect(label.FindStringSubmatch(labeled)[1]).To(Equal(label.FindStringSubmatch(unlabeled)[1]))
+			Expect(labeled).To(MatchRegexp(`
+LABEL io\.paketo\.ubi-nodejs\.build-inputs="sha256:[0-9a-f]{64}" \\
+      io\.paketo\.ubi-nodejs\.node\.package-file="/usr/share/ubi-nodejs-extension/node\.package" \\
+      io\.paketo\.ubi-nodejs\.node\.major-version="20" \\
+      io\.paketo\.ubi-nodejs\.stack="io\.buildpacks\.stacks\.ubi9"
+USER 1002:1000$`))
+		})
+	})
+
+	context("Writing the SBOM", func() {
+
+		it("Should list the packages installed since the start of the instruction", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+				SBOM:                 structs.SBOM{Path: "/usr/share/sbom/ubi-nodejs-extension", Script: "U2NyaXB0", Metadata: "TWV0YWRhdGE="},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN rpm -qa --qf '%{NEVRA}\n' > /tmp/rpms-before && \
+    microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    echo U2NyaXB0 | base64 -d > /tmp/sbom.js && \
+    node /tmp/sbom.js installed-since /tmp/rpms-before /usr/share/sbom/ubi-nodejs-extension TWV0YWRhdGE= && \
+    rm /tmp/sbom.js /tmp/rpms-before && \
+    microdnf clean all
+`))
+		})
+	})
+
+	context("Enforcing the GPG signature check", func() {
+
+		it("Should check for signing keys and install with the signature check", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:       20,
+				CNB_USER_ID:          1002,
+				CNB_GROUP_ID:         1000,
+				PACKAGES:             []string{"nodejs", "npm"},
+				ENABLE_NODEJS_MODULE: true,
+				GPGCHECK:             true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN (rpm -q gpg-pubkey > /dev/null 2>&1 || ls /etc/pki/rpm-gpg/RPM-GPG-KEY-* > /dev/null 2>&1 || \
+    (echo "No RPM signing keys found in the image to check the packages with" >&2 && exit 1)) && \
+    microdnf -y module enable nodejs:20 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs --setopt=gpgcheck=1 \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+`))
+		})
+	})
+
+	context("Installing locale and time zone data", func() {
+
+		it("Should install the langpacks and tzdata and set LANG and TZ", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:  20,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				PACKAGES:        []string{"nodejs", "npm"},
+				LOCALE_PACKAGES: []string{"glibc-langpack-de", "tzdata"},
+				LOCALE_ENV:      []structs.EnvVar{{Name: "LANG", Value: "de_DE.UTF-8"}, {Name: "TZ", Value: "Europe/Berlin"}},
+				TIMEZONE_DATA:   true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm glibc-langpack-de tzdata && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    ([ -e /usr/share/zoneinfo/UTC ] || microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    reinstall -y tzdata) && \
+    microdnf clean all
+
+ENV LANG=de_DE.UTF-8 \
+    TZ=Europe/Berlin
+`))
+		})
+
+		it("Should reinstall tzdata with the options of the install", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:  20,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				PACKAGES:        []string{"nodejs", "npm"},
+				PACKAGE_MANAGER: structs.PackageManager{Name: "dnf", Command: "dnf", InstallOptions: "--setopt=install_weak_deps=False --setopt=tsflags=nodocs"},
+				LOCALE_PACKAGES: []string{"tzdata"},
+				TIMEZONE_DATA:   true,
+				GPGCHECK:        true,
+				PACKAGE_CACHE:   true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`    ([ -e /usr/share/zoneinfo/UTC ] || dnf --setopt=install_weak_deps=False --setopt=tsflags=nodocs --setopt=gpgcheck=1 --setopt=cachedir=/kaniko/ubi-nodejs-extension/packages --setopt=keepcache=1 \
+    reinstall -y tzdata) && \
+`))
+		})
+	})
+
+	context("Installing the full ICU data", func() {
+
+		it("Should install the packages with Node.js and check the ICU data", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:    20,
+				CNB_USER_ID:       1002,
+				CNB_GROUP_ID:      1000,
+				PACKAGES:          []string{"nodejs", "npm"},
+				FULL_ICU_PACKAGES: []string{"nodejs-full-i18n"},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm nodejs-full-i18n && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all && \
+    (node -e "process.exit(new Intl.DateTimeFormat('es', { month: 'long' }).format(new Date(9e8)) === 'enero' ? 0 : 1)" || \
+    (echo "Full ICU data is not available to Node.js" >&2 && exit 1))
+`))
+		})
+	})
+
+	context("Keeping the package cache", func() {
+
+		it("Should keep the packages in the package cache dir outside of the image", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm"},
+				PACKAGE_CACHE:  true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(HavePrefix(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs --setopt=cachedir=/kaniko/ubi-nodejs-extension/packages --setopt=keepcache=1 \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+
+LABEL`))
+		})
+	})
 }
 
 func testGenerateRunDockerfile(t *testing.T, context spec.G, it spec.S) {
@@ -460,85 +1028,646 @@ func testGenerateRunDockerfile(t *testing.T, context spec.G, it spec.S) {
 
 		})
 	})
+
+	context("Extending the run image instead of switching it", func() {
+
+		it("Should install the Node.js runtime on top of the base image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:         true,
+				NODEJS_VERSION: 22,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "nodejs-npm"},
+				SYMLINKS: []structs.Symlink{
+					{Link: "/usr/bin/node", Target: "/usr/bin/node-22", Remove: true},
+					{Link: "/usr/bin/npm", Target: "/usr/bin/npm-22", Remove: true},
+					{Link: "/usr/bin/npx", Target: "/usr/bin/npx-22", Remove: true},
+				},
+				ENABLE_NODEJS_MODULE: false,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs nodejs-npm && \
+    rm /usr/bin/node && ln -s /usr/bin/node-22 /usr/bin/node && \
+    rm /usr/bin/npm && ln -s /usr/bin/npm-22 /usr/bin/npm && \
+    rm /usr/bin/npx && ln -s /usr/bin/npx-22 /usr/bin/npx && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+
+USER 1002:1000`))
+		})
+	})
+
+	context("Enabling FIPS mode on the run image", func() {
+
+		it("Should switch the crypto policy of the selected run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketobuildpacks/run-nodejs-20-ubi9-base",
+				FIPS:         true,
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi9-base
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y crypto-policies-scripts && \
+    update-crypto-policies --set FIPS && \
+    microdnf clean all && \
+    (OPENSSL_FORCE_FIPS_MODE=1 NODE_OPTIONS=--enable-fips node -p "crypto.getFips()" | grep -qx 1 || \
+    (echo "FIPS mode could not be enabled for Node.js" >&2 && exit 1))
+
+ENV OPENSSL_FORCE_FIPS_MODE=1 \
+    NODE_OPTIONS=--enable-fips
+
+USER 1002:1000`))
+		})
+
+		it("Should switch the crypto policy of the extended run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:       true,
+				FIPS:         true,
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				PACKAGES:     []string{"nodejs24", "nodejs24-npm"},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`    install -y nodejs24 nodejs24-npm crypto-policies-scripts && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    update-crypto-policies --set FIPS && \
+    microdnf clean all && \
+    (OPENSSL_FORCE_FIPS_MODE=1 NODE_OPTIONS=--enable-fips node -p "crypto.getFips()" | grep -qx 1 || \
+    (echo "FIPS mode could not be enabled for Node.js" >&2 && exit 1))
+
+ENV OPENSSL_FORCE_FIPS_MODE=1 \
+    NODE_OPTIONS=--enable-fips`))
+			Expect(output).To(HaveSuffix("\n\nUSER 1002:1000"))
+		})
+	})
+
+	context("Adding CA certificates to the run image", func() {
+
+		it("Should add the certificates to the trust store of the selected run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:          "paketobuildpacks/run-nodejs-20-ubi9-base",
+				CA_CERTIFICATES: []structs.File{{Name: "corporate-ca-root.pem", Content: "Um9vdA=="}},
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi9-base
+
+USER root
+
+RUN mkdir -p /etc/pki/ca-trust/source/anchors && \
+    echo Um9vdA== | base64 -d > /etc/pki/ca-trust/source/anchors/corporate-ca-root.pem && \
+    update-ca-trust
+
+ENV NODE_EXTRA_CA_CERTS=/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem
+
+USER 1002:1000`))
+		})
+	})
+
+	context("Adding custom package repositories to the run image", func() {
+
+		it("Should remove the repositories again after extending the run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:                       true,
+				PACKAGES:                     []string{"nodejs"},
+				CNB_USER_ID:                  1002,
+				CNB_GROUP_ID:                 1000,
+				REPOSITORIES:                 []structs.File{{Name: "internal.repo", Content: "UmVwbw=="}},
+				DISABLE_DEFAULT_REPOSITORIES: true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`ARG base_image
+FROM ${base_image}
+
+USER root
+
+RUN mkdir -p /etc/yum.repos.d /etc/pki/rpm-gpg && \
+    mkdir -p /etc/yum.repos.d.disabled && \
+    find /etc/yum.repos.d -maxdepth 1 -name '*.repo' -exec mv {} /etc/yum.repos.d.disabled/ \; && \
+    echo UmVwbw== | base64 -d > /etc/yum.repos.d/internal.repo && \
+    chmod 644 /etc/yum.repos.d/*.repo && \
+    microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all && \
+    rm -f /etc/yum.repos.d/internal.repo && \
+    find /etc/yum.repos.d.disabled -name '*.repo' -exec mv {} /etc/yum.repos.d/ \; && \
+    rmdir /etc/yum.repos.d.disabled
+
+USER 1002:1000`))
+		})
+
+		it("Should not use the repositories when only switching the run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketobuildpacks/run-nodejs-20-ubi9-base",
+				REPOSITORIES: []structs.File{{Name: "internal.repo", Content: "UmVwbw=="}},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi9-base`))
+		})
+	})
+
+	context("Writing the SBOM of the run image", func() {
+
+		var sbom structs.SBOM
+
+		it.Before(func() {
+			sbom = structs.SBOM{Path: "/usr/share/sbom/ubi-nodejs-extension", Script: "U2NyaXB0", Metadata: "TWV0YWRhdGE="}
+		})
+
+		it("Should list the packages installed into an extended run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:         true,
+				NODEJS_VERSION: 22,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				PACKAGES:       []string{"nodejs", "npm"},
+				SBOM:           sbom,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN rpm -qa --qf '%{NEVRA}\n' > /tmp/rpms-before && \
+    microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    echo U2NyaXB0 | base64 -d > /tmp/sbom.js && \
+    node /tmp/sbom.js installed-since /tmp/rpms-before /usr/share/sbom/ubi-nodejs-extension TWV0YWRhdGE= && \
+    rm /tmp/sbom.js /tmp/rpms-before && \
+    microdnf clean all
+`))
+		})
+
+		it("Should not list anything when only switching the run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source: "paketobuildpacks/run-nodejs-20-ubi9-base",
+				SBOM:   sbom,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi9-base`))
+		})
+	})
+
+	context("Enforcing the GPG signature check in the run image", func() {
+
+		it("Should check for signing keys and install with the signature check", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketobuildpacks/run-nodejs-20-ubi8-base",
+				FIPS:         true,
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				GPGCHECK:     true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN (rpm -q gpg-pubkey > /dev/null 2>&1 || ls /etc/pki/rpm-gpg/RPM-GPG-KEY-* > /dev/null 2>&1 || \
+    (echo "No RPM signing keys found in the image to check the packages with" >&2 && exit 1)) && \
+    microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs --setopt=gpgcheck=1 \
+    install -y crypto-policies-scripts && \
+`))
+		})
+	})
+
+	context("Preparing the run image for arbitrary user IDs", func() {
+
+		it("Should install nss_wrapper, set it up in the environment and give group 0 the permissions of the owner", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:              "paketobuildpacks/run-nodejs-20-ubi8-base",
+				CNB_USER_ID:         1002,
+				CNB_GROUP_ID:        0,
+				CNB_USER_HOME:       "/home/cnb",
+				OPENSHIFT:           true,
+				NSS_WRAPPER_PACKAGE: "nss_wrapper-libs",
+				NSS_WRAPPER_SCRIPT:  "U2NyaXB0",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi8-base
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nss_wrapper-libs && \
+    microdnf clean all && \
+    mkdir -p /etc/nss_wrapper /home/cnb && \
+    cp /etc/passwd /etc/nss_wrapper/passwd && \
+    echo U2NyaXB0 | base64 -d > /etc/nss_wrapper/nss_wrapper.sh && \
+    chmod 644 /etc/nss_wrapper/nss_wrapper.sh && \
+    chgrp -R 0 /etc/nss_wrapper /home/cnb && \
+    chmod -R g=u /etc/nss_wrapper /home/cnb
+
+ENV LD_PRELOAD=libnss_wrapper.so \
+    NSS_WRAPPER_PASSWD=/etc/nss_wrapper/passwd \
+    NSS_WRAPPER_GROUP=/etc/group \
+    BASH_ENV=/etc/nss_wrapper/nss_wrapper.sh \
+    HOME=/home/cnb
+
+USER 1002:0`))
+		})
+
+		it("Should fail for an invalid home directory of the CNB user", func() {
+
+			_, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:              "paketobuildpacks/run-nodejs-20-ubi8-base",
+				CNB_USER_ID:         1002,
+				CNB_GROUP_ID:        0,
+				CNB_USER_HOME:       "/home/cnb; rm -rf /",
+				OPENSHIFT:           true,
+				NSS_WRAPPER_PACKAGE: "nss_wrapper-libs",
+				NSS_WRAPPER_SCRIPT:  "U2NyaXB0",
+			})
+
+			Expect(err).To(MatchError("invalid home directory '/home/cnb; rm -rf /' of the CNB user"))
+		})
+
+		it("Should install nss_wrapper with the packages of an extended run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:              true,
+				NODEJS_VERSION:      20,
+				CNB_USER_ID:         1002,
+				CNB_GROUP_ID:        0,
+				CNB_USER_HOME:       "/home/cnb",
+				PACKAGES:            []string{"nodejs"},
+				OPENSHIFT:           true,
+				NSS_WRAPPER_PACKAGE: "nss_wrapper-libs",
+				NSS_WRAPPER_SCRIPT:  "U2NyaXB0",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring("install -y nodejs nss_wrapper-libs && \\\n"))
+			Expect(output).To(ContainSubstring("ENV LD_PRELOAD=libnss_wrapper.so"))
+		})
+	})
+
+	context("Validating the instructions", func() {
+
+		it("Should fail for an invalid environment variable instead of rendering it", func() {
+
+			_, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source: "paketobuildpacks/run-nodejs-20-ubi8-base",
+				ENV:    []structs.EnvVar{{Name: "NODE_ENV", Value: "production\nUSER root"}},
+			})
+
+			Expect(err).To(MatchError("the value of ENV NODE_ENV must not span several lines"))
+		})
+
+		it("Should fail for a run image with whitespace", func() {
+
+			_, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source: "paketobuildpacks/run-nodejs-20-ubi8-base AS run",
+			})
+
+			Expect(err).To(MatchError("invalid FROM image 'paketobuildpacks/run-nodejs-20-ubi8-base AS run'"))
+		})
+	})
+
+	context("Configuring the processes of the run image", func() {
+
+		it("Should set the environment variables and the user of a switched run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source: "paketobuildpacks/run-nodejs-20-ubi8-base",
+				ENV: []structs.EnvVar{
+					{Name: "NODE_ENV", Value: "production"},
+					{Name: "NODE_OPTIONS", Value: `--title="$APP"`},
+				},
+				RUN_USER: "1002:0",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi8-base
+
+ENV NODE_ENV=production \
+    NODE_OPTIONS="--title=\"\$APP\""
+
+USER 1002:0`))
+		})
+	})
+
+	context("Installing locale and time zone data in the run image", func() {
+
+		it("Should extend a switched run image with the langpacks and tzdata", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:          "paketobuildpacks/run-nodejs-20-ubi8-base",
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				LOCALE_PACKAGES: []string{"glibc-langpack-de", "tzdata"},
+				TIMEZONE_DATA:   true,
+				ENV:             []structs.EnvVar{{Name: "LANG", Value: "de_DE.UTF-8"}},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi8-base
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y glibc-langpack-de tzdata && \
+    ([ -e /usr/share/zoneinfo/UTC ] || microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    reinstall -y tzdata) && \
+    microdnf clean all
+
+USER 1002:1000
+
+ENV LANG=de_DE.UTF-8`))
+		})
+	})
+
+	context("Installing the full ICU data in the run image", func() {
+
+		it("Should extend a switched run image with the packages and check the ICU data", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:            "paketobuildpacks/run-nodejs-20-ubi8-base",
+				CNB_USER_ID:       1002,
+				CNB_GROUP_ID:      1000,
+				FULL_ICU_PACKAGES: []string{"nodejs-full-i18n"},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi8-base
+
+USER root
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs \
+    install -y nodejs-full-i18n && \
+    microdnf clean all && \
+    (node -e "process.exit(new Intl.DateTimeFormat('es', { month: 'long' }).format(new Date(9e8)) === 'enero' ? 0 : 1)" || \
+    (echo "Full ICU data is not available to Node.js" >&2 && exit 1))
+
+USER 1002:1000`))
+		})
+
+		it("Should install the packages with the runtime of an extended run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:            true,
+				NODEJS_VERSION:    22,
+				CNB_USER_ID:       1002,
+				CNB_GROUP_ID:      1000,
+				PACKAGES:          []string{"nodejs24", "nodejs24-npm"},
+				FULL_ICU_PACKAGES: []string{"nodejs24-full-i18n"},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring("install -y nodejs24 nodejs24-npm nodejs24-full-i18n && \\\n"))
+			Expect(output).To(ContainSubstring("Full ICU data is not available to Node.js"))
+		})
+	})
+
+	context("Labeling the run image", func() {
+
+		it("Should add the labels in a single instruction", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source: "paketobuildpacks/run-nodejs-20-ubi9-base",
+				LABELS: []structs.Label{
+					{Name: "io.paketo.ubi-nodejs.node.major-version", Value: "20"},
+					{Name: "io.paketo.ubi-nodejs.run-image", Value: "paketobuildpacks/run-nodejs-20-ubi9-base"},
+				},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketobuildpacks/run-nodejs-20-ubi9-base
+
+LABEL io.paketo.ubi-nodejs.node.major-version="20" \
+      io.paketo.ubi-nodejs.run-image="paketobuildpacks/run-nodejs-20-ubi9-base"`))
+		})
+
+		it("Should point at the installed Node.js package of an extended run image", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				EXTEND:       true,
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				PACKAGES:     []string{"nodejs24", "nodejs24-npm"},
+				LABELS:       []structs.Label{{Name: "io.paketo.ubi-nodejs.node.major-version", Value: "24"}},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`    install -y nodejs24 nodejs24-npm && \
+    mkdir -p /usr/share/ubi-nodejs-extension && \
+    rpm -qf --qf '%{NAME}-%{EPOCHNUM}:%{VERSION}-%{RELEASE}.%{ARCH}\n' "$(readlink -f "$(command -v node)")" > /usr/share/ubi-nodejs-extension/node.package && \
+    microdnf clean all
+`))
+			Expect(output).To(HaveSuffix(`LABEL io.paketo.ubi-nodejs.node.major-version="24" \
+      io.paketo.ubi-nodejs.node.package-file="/usr/share/ubi-nodejs-extension/node.package"`))
+		})
+	})
+}
+
+func testGetRunPackages(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should return the runtime packages for the supported combinations", func() {
+		testCases := []struct {
+			stackId          string
+			nodeVersion      int
+			expectedPackages []string
+		}{
+			{stackId: "io.buildpacks.stacks.ubi8", nodeVersion: 18, expectedPackages: []string{"nodejs", "npm"}},
+			{stackId: "io.buildpacks.stacks.ubi8", nodeVersion: 22, expectedPackages: []string{"nodejs", "npm"}},
+			{stackId: "io.buildpacks.stacks.ubi9", nodeVersion: 24, expectedPackages: []string{"nodejs", "npm"}},
+			{stackId: "io.buildpacks.stacks.ubi10", nodeVersion: 22, expectedPackages: []string{"nodejs", "nodejs-npm"}},
+			{stackId: "io.buildpacks.stacks.ubi10", nodeVersion: 24, expectedPackages: []string{"nodejs24", "nodejs24-npm"}},
+		}
+
+		for _, tt := range testCases {
+			nodeProfile, err := utils.GetNodeProfile(tt.stackId, "amd64", tt.nodeVersion)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodeProfile.GetRunPackages()).To(Equal(tt.expectedPackages))
+		}
+	})
+
+	it("should not return gcc symlinks for the run image", func() {
+		nodeProfile, err := utils.GetNodeProfile("io.buildpacks.stacks.ubi8", "amd64", 22)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetSymlinks()).To(ContainElement(structs.Symlink{Link: "/usr/bin/gcc", Target: "/opt/rh/gcc-toolset-13/root/usr/bin/gcc", Force: true}))
+		Expect(nodeProfile.GetRunSymlinks()).To(BeEmpty())
+	})
+
+	it("should error for unsupported combinations", func() {
+		_, err := utils.GetNodeProfile("io.buildpacks.stacks.ubi9", "amd64", 16)
+		Expect(err).To(MatchError("unsupported Node.js version 16 for image io.buildpacks.stacks.ubi9"))
+	})
+
+	it("should return the nss_wrapper package of the build packages", func() {
+		nodeProfile, err := utils.GetNodeProfile("io.buildpacks.stacks.ubi8", "amd64", 18)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetNssWrapperPackage()).To(Equal("nss_wrapper"))
+
+		nodeProfile, err = utils.GetNodeProfile("io.buildpacks.stacks.ubi10", "amd64", 24)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeProfile.GetNssWrapperPackage()).To(Equal("nss_wrapper-libs"))
+	})
 }
 
 func testGetDuringBuildPermissions(t *testing.T, context spec.G, it spec.S) {
 
-	var Expect = NewWithT(t).Expect
+	var (
+		Expect     = NewWithT(t).Expect
+		passwdPath string
+		groupPath  string
+		env        map[string]string
+	)
 
-	context("/etc/passwd exists and has the cnb user", func() {
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
 
-		it("It should return the permissions specified for the cnb user", func() {
-			tmpDir := t.TempDir()
-			path := filepath.Join(tmpDir, "/passwd")
-			Expect(os.WriteFile(path, []byte(`root:x:0:0:root:/root:/bin/bash
+	it.Before(func() {
+		tmpDir := t.TempDir()
+		passwdPath = filepath.Join(tmpDir, "passwd")
+		groupPath = filepath.Join(tmpDir, "group")
+		env = map[string]string{}
+
+		Expect(os.WriteFile(passwdPath, []byte(`root:x:0:0:root:/root:/bin/bash
 bin:x:1:1:bin:/bin:/sbin/nologin
-daemon:x:2:2:daemon:/sbin:/sbin/nologin
-adm:x:3:4:adm:/var/adm:/sbin/nologin
-lp:x:4:7:lp:/var/spool/lpd:/sbin/nologin
-sync:x:5:0:sync:/sbin:/bin/sync
-shutdown:x:6:0:shutdown:/sbin:/sbin/shutdown
-halt:x:7:0:halt:/sbin:/sbin/halt
-mail:x:8:12:mail:/var/spool/mail:/sbin/nologin
-operator:x:11:0:operator:/root:/sbin/nologin
-games:x:12:100:games:/usr/games:/sbin/nologin
-ftp:x:14:50:FTP User:/var/ftp:/sbin/nologin
-cnb:x:1234:2345::/home/cnb:/bin/bash
+# the user of the buildpacks
+cnb:x:1234:2345:Cloud Native Buildpacks:/workspace:/bin/bash
+builder:x:1500:1501::/home/builder:/bin/sh
+
 nobody:x:65534:65534:Kernel Overflow User:/:/sbin/nologin
 `), 0600)).To(Succeed())
+		Expect(os.WriteFile(groupPath, []byte(`root:x:0:
+cnb:x:2345:
+builders:x:1600:cnb,builder
+`), 0600)).To(Succeed())
+	})
 
-			duringBuilderPermissions := utils.GetDuringBuildPermissions(path)
+	context("/etc/passwd exists and has the cnb user", func() {
 
-			Expect(duringBuilderPermissions).To(Equal(
+		it("It should return the permissions specified for the cnb user", func() {
+			duringBuildPermissions, source, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duringBuildPermissions).To(Equal(
 				structs.DuringBuildPermissions{
-					CNB_USER_ID:  1234,
-					CNB_GROUP_ID: 2345,
+					CNB_USER_ID:   1234,
+					CNB_GROUP_ID:  2345,
+					CNB_USER_HOME: "/workspace",
 				},
 			))
+			Expect(source).To(Equal(fmt.Sprintf("user 'cnb' in %s", passwdPath)))
+		})
+
+		it("It should return the permissions of the user named by BP_UBI_CNB_USER", func() {
+			env["BP_UBI_CNB_USER"] = "builder"
+
+			duringBuildPermissions, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duringBuildPermissions).To(Equal(structs.DuringBuildPermissions{CNB_USER_ID: 1500, CNB_GROUP_ID: 1501, CNB_USER_HOME: "/home/builder"}))
+		})
+
+		it("It should return the group named by BP_UBI_CNB_GROUP", func() {
+			env["BP_UBI_CNB_GROUP"] = "builders"
+
+			duringBuildPermissions, source, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duringBuildPermissions).To(Equal(structs.DuringBuildPermissions{CNB_USER_ID: 1234, CNB_GROUP_ID: 1600, CNB_USER_HOME: "/workspace"}))
+			Expect(source).To(Equal(fmt.Sprintf("user 'cnb' in %s and group 'builders' in %s", passwdPath, groupPath)))
 		})
 	})
 
-	context("/etc/passwd exists and does NOT have the cnb user", func() {
+	context("CNB_USER_ID and CNB_GROUP_ID are set", func() {
 
-		it("It should return the default permissions", func() {
-			tmpDir := t.TempDir()
-			path := filepath.Join(tmpDir, "/passwd")
+		it("It should prefer them over /etc/passwd", func() {
+			env["CNB_USER_ID"] = "1002"
+			env["CNB_GROUP_ID"] = "1000"
 
-			Expect(os.WriteFile(path, []byte(`root:x:0:0:root:/root:/bin/bash
-bin:x:1:1:bin:/bin:/sbin/nologin
-daemon:x:2:2:daemon:/sbin:/sbin/nologin
-adm:x:3:4:adm:/var/adm:/sbin/nologin
-lp:x:4:7:lp:/var/spool/lpd:/sbin/nologin
-sync:x:5:0:sync:/sbin:/bin/sync
-shutdown:x:6:0:shutdown:/sbin:/sbin/shutdown
-halt:x:7:0:halt:/sbin:/sbin/halt
-mail:x:8:12:mail:/var/spool/mail:/sbin/nologin
-operator:x:11:0:operator:/root:/sbin/nologin
-games:x:12:100:games:/usr/games:/sbin/nologin
-ftp:x:14:50:FTP User:/var/ftp:/sbin/nologin
-nobody:x:65534:65534:Kernel Overflow User:/:/sbin/nologin
-`), 0600)).To(Succeed())
+			duringBuildPermissions, source, err := utils.GetDuringBuildPermissions(filepath.Join(t.TempDir(), "passwd"), groupPath, lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duringBuildPermissions).To(Equal(structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000}))
+			Expect(source).To(Equal("CNB_USER_ID and CNB_GROUP_ID"))
+		})
 
-			duringBuildPermissions := utils.GetDuringBuildPermissions(path)
+		it("It should take the group of the user with the ID of CNB_USER_ID", func() {
+			env["CNB_USER_ID"] = "1500"
 
-			Expect(duringBuildPermissions).To(Equal(
-				structs.DuringBuildPermissions{
-					CNB_USER_ID:  constants.DEFAULT_USER_ID,
-					CNB_GROUP_ID: constants.DEFAULT_GROUP_ID},
-			))
+			duringBuildPermissions, source, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duringBuildPermissions).To(Equal(structs.DuringBuildPermissions{CNB_USER_ID: 1500, CNB_GROUP_ID: 1501, CNB_USER_HOME: "/home/builder"}))
+			Expect(source).To(Equal(fmt.Sprintf("CNB_USER_ID and user 'builder' in %s", passwdPath)))
 		})
 	})
 
-	context("/etc/passwd does NOT exist", func() {
-		it("It should return the default permissions", func() {
-			tmpDir := t.TempDir()
-			duringBuilderPermissions := utils.GetDuringBuildPermissions(tmpDir)
+	context("Failure cases", func() {
 
-			Expect(duringBuilderPermissions).To(Equal(
-				structs.DuringBuildPermissions{
-					CNB_USER_ID:  constants.DEFAULT_USER_ID,
-					CNB_GROUP_ID: constants.DEFAULT_GROUP_ID},
-			))
+		it("It should error when /etc/passwd does NOT have the cnb user", func() {
+			env["BP_UBI_CNB_USER"] = "node"
+
+			_, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).To(MatchError(fmt.Sprintf("user 'node' not found in %s, set CNB_USER_ID and CNB_GROUP_ID or BP_UBI_CNB_USER", passwdPath)))
+		})
+
+		it("It should error when /etc/passwd does NOT exist", func() {
+			_, _, err := utils.GetDuringBuildPermissions(filepath.Join(t.TempDir(), "passwd"), groupPath, lookupEnv)
+			Expect(err).To(MatchError(ContainSubstring("failed to read")))
+		})
+
+		it("It should error when the group of CNB_USER_ID can not be determined", func() {
+			env["CNB_USER_ID"] = "4321"
+
+			_, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).To(MatchError(fmt.Sprintf("no user with the ID 4321 of CNB_USER_ID found in %s to take the group from, set CNB_GROUP_ID or BP_UBI_CNB_GROUP", passwdPath)))
+		})
+
+		it("It should error for an unknown BP_UBI_CNB_GROUP", func() {
+			env["BP_UBI_CNB_GROUP"] = "wheel"
+
+			_, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).To(MatchError(fmt.Sprintf("group 'wheel' of BP_UBI_CNB_GROUP not found in %s", groupPath)))
+		})
+
+		it("It should error for a non-numeric CNB_USER_ID", func() {
+			env["CNB_USER_ID"] = "cnb"
+
+			_, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).To(MatchError("invalid CNB_USER_ID value 'cnb', expected a numeric ID"))
+		})
+
+		it("It should error for a malformed entry", func() {
+			Expect(os.WriteFile(passwdPath, []byte("root:x:0:0:root:/root:/bin/bash\ncnb:x:cnb:1000::/home/cnb:/bin/bash\n"), 0600)).To(Succeed())
+
+			_, _, err := utils.GetDuringBuildPermissions(passwdPath, groupPath, lookupEnv)
+			Expect(err).To(MatchError(fmt.Sprintf("malformed ID 'cnb' on line 2 of %s", passwdPath)))
 		})
 	})
 }
@@ -554,40 +1683,40 @@ func testGetBuildPackages(t *testing.T, context spec.G, it spec.S) {
 			testCases := []struct {
 				stackId          string
 				nodeVersion      int
-				expectedPackages string
+				expectedPackages []string
 				description      string
 			}{
 				// UBI8
 				{
 					stackId:          "io.buildpacks.stacks.ubi8",
 					nodeVersion:      16,
-					expectedPackages: "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3",
+					expectedPackages: []string{"make", "gcc", "gcc-c++", "libatomic_ops", "git", "openssl-devel", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper", "which", "python3"},
 					description:      "UBI8 with Node.js 16",
 				},
 				{
 					stackId:          "io.buildpacks.stacks.ubi8",
 					nodeVersion:      18,
-					expectedPackages: "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3",
+					expectedPackages: []string{"make", "gcc", "gcc-c++", "libatomic_ops", "git", "openssl-devel", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper", "which", "python3"},
 					description:      "UBI8 with Node.js 18",
 				},
 				{
 					stackId:          "io.buildpacks.stacks.ubi8",
 					nodeVersion:      20,
-					expectedPackages: "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3",
+					expectedPackages: []string{"make", "gcc", "gcc-c++", "libatomic_ops", "git", "openssl-devel", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper", "which", "python3"},
 					description:      "UBI8 with Node.js 20",
 				},
 				{
 					stackId:          "io.buildpacks.stacks.ubi8",
 					nodeVersion:      22,
-					expectedPackages: "make gcc-toolset-13-gcc gcc-toolset-13-gcc-c++ gcc-toolset-13-runtime libatomic_ops git openssl-devel python3.12 nodejs npm nodejs-nodemon nss_wrapper-libs which",
+					expectedPackages: []string{"make", "gcc-toolset-13-gcc", "gcc-toolset-13-gcc-c++", "gcc-toolset-13-runtime", "libatomic_ops", "git", "openssl-devel", "python3.12", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper-libs", "which"},
 					description:      "UBI8 with Node.js 22 (uses GCC toolset 13)",
 				},
 			}
 
 			for _, tt := range testCases {
-				packages, err := utils.GetBuildPackages(tt.stackId, tt.nodeVersion)
+				nodeProfile, err := utils.GetNodeProfile(tt.stackId, "amd64", tt.nodeVersion)
 				Expect(err).NotTo(HaveOccurred(), "Failed for: %s", tt.description)
-				Expect(packages).To(Equal(tt.expectedPackages), "Package mismatch for: %s", tt.description)
+				Expect(nodeProfile.GetBuildPackages()).To(Equal(tt.expectedPackages), "Package mismatch for: %s", tt.description)
 			}
 		})
 	})
@@ -615,10 +1744,10 @@ func testGetBuildPackages(t *testing.T, context spec.G, it spec.S) {
 			}
 
 			for _, tt := range testCases {
-				packages, err := utils.GetBuildPackages(tt.stackId, tt.nodeVersion)
+				nodeProfile, err := utils.GetNodeProfile(tt.stackId, "amd64", tt.nodeVersion)
 				Expect(err).To(HaveOccurred(), "Expected error for: %s", tt.description)
 				Expect(err.Error()).To(Equal(tt.expectedError), "Error message mismatch for: %s", tt.description)
-				Expect(packages).To(BeEmpty(), "Expected empty packages for: %s", tt.description)
+				Expect(nodeProfile.GetBuildPackages()).To(BeEmpty(), "Expected empty packages for: %s", tt.description)
 			}
 		})
 
@@ -650,10 +1779,10 @@ func testGetBuildPackages(t *testing.T, context spec.G, it spec.S) {
 			}
 
 			for _, tt := range testCases {
-				packages, err := utils.GetBuildPackages(tt.stackId, tt.nodeVersion)
+				nodeProfile, err := utils.GetNodeProfile(tt.stackId, "amd64", tt.nodeVersion)
 				Expect(err).To(HaveOccurred(), "Expected error for: %s", tt.description)
 				Expect(err.Error()).To(Equal(tt.expectedError), "Error message mismatch for: %s", tt.description)
-				Expect(packages).To(BeEmpty(), "Expected empty packages for: %s", tt.description)
+				Expect(nodeProfile.GetBuildPackages()).To(BeEmpty(), "Expected empty packages for: %s", tt.description)
 			}
 		})
 	})
@@ -0,0 +1,646 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+)
+
+const VulnerabilityFeedBindingType = "vulnerability-feed"
+
+// severities ranks the severities the feeds are normalized to. Unknown
+// severities rank lowest, whether they block the build is up to the caller.
+var severities = map[string]int{
+	"unknown":  0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+var severityAliases = map[string]string{
+	"moderate":  "medium",
+	"important": "high",
+}
+
+var nodejsPackageNames = map[string]bool{
+	"node":   true,
+	"nodejs": true,
+}
+
+var ovalNodejsCriterion = regexp.MustCompile(`^nodejs is earlier than (\S+)$`)
+
+// VulnerabilityFeed is an OSV, OpenVEX or OVAL document, named after the file
+// or binding entry it was read from.
+type VulnerabilityFeed struct {
+	Name    string
+	Content []byte
+}
+
+// Vulnerability is a vulnerability of the feeds affecting Node.js or the run
+// image.
+type Vulnerability struct {
+	ID       string
+	Severity string
+
+	// Target is what is affected, the Node.js package, version or stream, or
+	// the run image, and Fixed the version of the feed fixing the
+	// vulnerability, if any.
+	Target string
+	Fixed  string
+}
+
+// Rank returns the rank of the severity of the vulnerability, as
+// GetSeverityRank does.
+func (v Vulnerability) Rank() int {
+	return severities[v.Severity]
+}
+
+func (v Vulnerability) String() string {
+	if v.Fixed != "" {
+		return fmt.Sprintf("%s (%s) in %s, fixed in %s", v.ID, v.Severity, v.Target, v.Fixed)
+	}
+	return fmt.Sprintf("%s (%s) in %s", v.ID, v.Severity, v.Target)
+}
+
+// GetSeverityRank returns the rank of a severity, higher ranks being more
+// severe.
+func GetSeverityRank(severity string) (int, error) {
+	normalized := normalizeSeverity(severity)
+	if normalized == "unknown" {
+		return 0, fmt.Errorf("unsupported severity '%s', expected 'low', 'medium', 'high' or 'critical'", severity)
+	}
+	return severities[normalized], nil
+}
+
+// GetVulnerabilityFeeds returns the feeds of feedPath, a file or a directory
+// of files, and of the entries of all the vulnerability-feed service
+// bindings.
+func GetVulnerabilityFeeds(feedPath, platformPath string) ([]VulnerabilityFeed, error) {
+	var feeds []VulnerabilityFeed
+
+	if feedPath != "" {
+		info, err := os.Stat(feedPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vulnerability feed: %w", err)
+		}
+
+		files := []string{feedPath}
+		if info.IsDir() {
+			entries, err := os.ReadDir(feedPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read vulnerability feeds: %w", err)
+			}
+			files = nil
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					files = append(files, filepath.Join(feedPath, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read vulnerability feed: %w", err)
+			}
+			feeds = append(feeds, VulnerabilityFeed{Name: file, Content: content})
+		}
+	}
+
+	bindings, err := servicebindings.NewResolver().Resolve(VulnerabilityFeedBindingType, "", platformPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s bindings: %w", VulnerabilityFeedBindingType, err)
+	}
+
+	for _, binding := range bindings {
+		for _, name := range sortedEntryNames(binding) {
+			content, err := binding.Entries[name].ReadBytes()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read entry %s of binding %s: %w", name, binding.Name, err)
+			}
+			feeds = append(feeds, VulnerabilityFeed{Name: fmt.Sprintf("entry %s of binding %s", name, binding.Name), Content: content})
+		}
+	}
+
+	return feeds, nil
+}
+
+// FindVulnerabilities returns the vulnerabilities of the feeds affecting the
+// Node.js stream of nodeMajorVersion, or nodePackage when the exact version
+// is known, and the runImage, sorted by decreasing severity. nodePackage is
+// the name-[epoch:]version-release[.arch] of the Node.js package, or only its
+// version, which is compared with the feeds the way rpm compares versions.
+//
+// Without the exact version, the stream is only affected by vulnerabilities
+// that are not fixed in it, as the latest version of the stream gets
+// installed. OpenVEX statements that Node.js or the run image is not affected
+// by, or fixed for, a vulnerability leave it out, and the ones that they are
+// affected add it. Statements about a given Node.js version only apply when
+// it is the exact version.
+func FindVulnerabilities(feeds []VulnerabilityFeed, nodeMajorVersion uint64, nodePackage string, runImage string) ([]Vulnerability, error) {
+	var version *rpmVersion
+	target := fmt.Sprintf("Node.js %d", nodeMajorVersion)
+	if nodePackage != "" {
+		parsed, err := parseNodejsPackage(nodePackage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Node.js version '%s': %w", nodePackage, err)
+		}
+		if parsed.isExact() {
+			version = &parsed
+			target = nodePackage
+			if unicode.IsDigit(rune(nodePackage[0])) || nodePackage[0] == 'v' {
+				target = fmt.Sprintf("Node.js %s", nodePackage)
+			}
+		}
+	}
+
+	var advisories []advisory
+	var statements []vexStatement
+	for _, feed := range feeds {
+		feedAdvisories, feedStatements, err := parseVulnerabilityFeed(feed.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vulnerability feed %s: %w", feed.Name, err)
+		}
+		advisories = append(advisories, feedAdvisories...)
+		statements = append(statements, feedStatements...)
+	}
+
+	suppressed := map[string]bool{}
+	affected := map[string]string{}
+	for _, statement := range statements {
+		var statementTarget string
+		for _, product := range statement.products {
+			if isNodejsProduct(product, nodeMajorVersion, version) {
+				statementTarget = target
+			} else if runImage != "" && isImageProduct(product, runImage) {
+				statementTarget = runImage
+			}
+		}
+		if statementTarget == "" {
+			continue
+		}
+
+		switch statement.status {
+		case "not_affected", "fixed":
+			for _, id := range statement.ids {
+				suppressed[id] = true
+			}
+		case "affected":
+			affected[statement.ids[0]] = statementTarget
+		}
+	}
+
+	var vulnerabilities []Vulnerability
+	seen := map[string]bool{}
+	for _, advisory := range advisories {
+		if advisory.isSuppressed(suppressed) || seen[advisory.ids[0]] {
+			continue
+		}
+
+		isAffected, fixed, err := advisory.affects(nodeMajorVersion, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match %s: %w", advisory.ids[0], err)
+		}
+		if isAffected {
+			seen[advisory.ids[0]] = true
+			vulnerabilities = append(vulnerabilities, Vulnerability{ID: advisory.ids[0], Severity: advisory.severity, Target: target, Fixed: fixed})
+		}
+	}
+
+	for id, statementTarget := range affected {
+		if seen[id] || suppressed[id] {
+			continue
+		}
+		seen[id] = true
+
+		// OpenVEX has no severities, they are taken from the advisories.
+		severity := "unknown"
+		for _, advisory := range advisories {
+			if advisory.hasID(id) {
+				severity = advisory.severity
+			}
+		}
+		vulnerabilities = append(vulnerabilities, Vulnerability{ID: id, Severity: severity, Target: statementTarget})
+	}
+
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		if severities[vulnerabilities[i].Severity] != severities[vulnerabilities[j].Severity] {
+			return severities[vulnerabilities[i].Severity] > severities[vulnerabilities[j].Severity]
+		}
+		return vulnerabilities[i].ID < vulnerabilities[j].ID
+	})
+
+	return vulnerabilities, nil
+}
+
+// advisory is a vulnerability of Node.js, with ids starting with its own
+// followed by its aliases.
+type advisory struct {
+	ids      []string
+	severity string
+	ranges   []affectedRange
+}
+
+// affectedRange is a range of Node.js versions, with an empty fixed version
+// for ranges that are open ended.
+type affectedRange struct {
+	introduced   string
+	fixed        string
+	lastAffected bool
+}
+
+func (a advisory) hasID(id string) bool {
+	for _, advisoryID := range a.ids {
+		if advisoryID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (a advisory) isSuppressed(suppressed map[string]bool) bool {
+	for _, id := range a.ids {
+		if suppressed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a advisory) affects(nodeMajorVersion uint64, version *rpmVersion) (bool, string, error) {
+	for _, r := range a.ranges {
+		introduced := rpmVersion{version: "0"}
+		if r.introduced != "" && r.introduced != "0" {
+			var err error
+			introduced, err = parseRPMVersion(r.introduced)
+			if err != nil {
+				return false, "", err
+			}
+		}
+
+		var fixed *rpmVersion
+		if r.fixed != "" {
+			parsed, err := parseRPMVersion(r.fixed)
+			if err != nil {
+				return false, "", err
+			}
+			fixed = &parsed
+		}
+
+		if version != nil {
+			if version.compare(introduced) < 0 {
+				continue
+			}
+			if fixed == nil || version.compare(*fixed) < 0 || (r.lastAffected && version.compare(*fixed) == 0) {
+				if r.lastAffected || fixed == nil {
+					return true, "", nil
+				}
+				return true, r.fixed, nil
+			}
+			continue
+		}
+
+		if introduced.major() > nodeMajorVersion {
+			continue
+		}
+		if fixed == nil || fixed.major() > nodeMajorVersion || (r.lastAffected && fixed.major() == nodeMajorVersion) {
+			return true, "", nil
+		}
+	}
+
+	return false, "", nil
+}
+
+type vexStatement struct {
+	ids      []string
+	products []string
+	status   string
+}
+
+func parseVulnerabilityFeed(content []byte) ([]advisory, []vexStatement, error) {
+	content = bytes.TrimSpace(content)
+	if bytes.HasPrefix(content, []byte("<")) {
+		advisories, err := parseOVAL(content)
+		return advisories, nil, err
+	}
+
+	if bytes.HasPrefix(content, []byte("[")) {
+		var entries []osvEntry
+		if err := json.Unmarshal(content, &entries); err != nil {
+			return nil, nil, err
+		}
+		return osvAdvisories(entries), nil, nil
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := document["statements"]; ok {
+		statements, err := parseOpenVEX(content)
+		return nil, statements, err
+	}
+
+	if vulns, ok := document["vulns"]; ok {
+		var entries []osvEntry
+		if err := json.Unmarshal(vulns, &entries); err != nil {
+			return nil, nil, err
+		}
+		return osvAdvisories(entries), nil, nil
+	}
+
+	if _, ok := document["affected"]; ok {
+		var entry osvEntry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return nil, nil, err
+		}
+		return osvAdvisories([]osvEntry{entry}), nil, nil
+	}
+
+	return nil, nil, fmt.Errorf("neither an OSV, OpenVEX nor OVAL document")
+}
+
+type osvSeverity struct {
+	Severity string `json:"severity"`
+}
+
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+			PURL string `json:"purl"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		EcosystemSpecific osvSeverity `json:"ecosystem_specific"`
+		DatabaseSpecific  osvSeverity `json:"database_specific"`
+	} `json:"affected"`
+	DatabaseSpecific osvSeverity `json:"database_specific"`
+}
+
+func osvAdvisories(entries []osvEntry) []advisory {
+	var advisories []advisory
+	for _, entry := range entries {
+		a := advisory{
+			ids:      append([]string{entry.ID}, entry.Aliases...),
+			severity: normalizeSeverity(entry.DatabaseSpecific.Severity),
+		}
+
+		for _, affected := range entry.Affected {
+			name := affected.Package.Name
+			if affected.Package.PURL != "" {
+				name = purlName(affected.Package.PURL)
+			}
+			if !nodejsPackageNames[strings.ToLower(name)] {
+				continue
+			}
+
+			for _, severity := range []string{affected.EcosystemSpecific.Severity, affected.DatabaseSpecific.Severity} {
+				if severities[normalizeSeverity(severity)] > severities[a.severity] {
+					a.severity = normalizeSeverity(severity)
+				}
+			}
+
+			for _, osvRange := range affected.Ranges {
+				open := false
+				for _, event := range osvRange.Events {
+					if introduced, ok := event["introduced"]; ok {
+						a.ranges = append(a.ranges, affectedRange{introduced: introduced})
+						open = true
+					} else if fixed, ok := event["fixed"]; ok && open {
+						a.ranges[len(a.ranges)-1].fixed = fixed
+						open = false
+					} else if lastAffected, ok := event["last_affected"]; ok && open {
+						a.ranges[len(a.ranges)-1].fixed = lastAffected
+						a.ranges[len(a.ranges)-1].lastAffected = true
+						open = false
+					}
+				}
+			}
+		}
+
+		if len(a.ranges) > 0 {
+			advisories = append(advisories, a)
+		}
+	}
+	return advisories
+}
+
+type ovalCriteria struct {
+	Criteria  []ovalCriteria `xml:"criteria"`
+	Criterion []struct {
+		Comment string `xml:"comment,attr"`
+	} `xml:"criterion"`
+}
+
+func (c ovalCriteria) comments() []string {
+	var comments []string
+	for _, criterion := range c.Criterion {
+		comments = append(comments, criterion.Comment)
+	}
+	for _, criteria := range c.Criteria {
+		comments = append(comments, criteria.comments()...)
+	}
+	return comments
+}
+
+type ovalDocument struct {
+	Definitions []struct {
+		ID       string `xml:"id,attr"`
+		Metadata struct {
+			References []struct {
+				ID     string `xml:"ref_id,attr"`
+				Source string `xml:"source,attr"`
+			} `xml:"reference"`
+			Severity string `xml:"advisory>severity"`
+		} `xml:"metadata"`
+		Criteria ovalCriteria `xml:"criteria"`
+	} `xml:"definitions>definition"`
+}
+
+// parseOVAL returns the advisories of the OVAL definitions with a "nodejs is
+// earlier than <version>" criterion, each fixed version closing the range of
+// its stream.
+func parseOVAL(content []byte) ([]advisory, error) {
+	var document ovalDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	var advisories []advisory
+	for _, definition := range document.Definitions {
+		a := advisory{severity: normalizeSeverity(definition.Metadata.Severity)}
+		for _, reference := range definition.Metadata.References {
+			if reference.Source == "CVE" {
+				a.ids = append(a.ids, reference.ID)
+			} else {
+				a.ids = append([]string{reference.ID}, a.ids...)
+			}
+		}
+		if len(a.ids) == 0 {
+			a.ids = []string{definition.ID}
+		}
+
+		for _, comment := range definition.Criteria.comments() {
+			matches := ovalNodejsCriterion.FindStringSubmatch(comment)
+			if matches == nil {
+				continue
+			}
+
+			fixed, err := parseRPMVersion(matches[1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse version '%s' of %s: %w", matches[1], a.ids[0], err)
+			}
+			a.ranges = append(a.ranges, affectedRange{introduced: fmt.Sprintf("%d", fixed.major()), fixed: matches[1]})
+		}
+
+		if len(a.ranges) > 0 {
+			advisories = append(advisories, a)
+		}
+	}
+	return advisories, nil
+}
+
+type openVEXDocument struct {
+	Statements []struct {
+		Vulnerability json.RawMessage   `json:"vulnerability"`
+		Products      []json.RawMessage `json:"products"`
+		Status        string            `json:"status"`
+	} `json:"statements"`
+}
+
+// parseOpenVEX returns the statements of an OpenVEX document, whose
+// vulnerabilities and products are either names or objects.
+func parseOpenVEX(content []byte) ([]vexStatement, error) {
+	var document openVEXDocument
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	var statements []vexStatement
+	for _, s := range document.Statements {
+		statement := vexStatement{status: s.Status}
+
+		var name string
+		if err := json.Unmarshal(s.Vulnerability, &name); err == nil {
+			statement.ids = []string{name}
+		} else {
+			var vulnerability struct {
+				Name    string   `json:"name"`
+				Aliases []string `json:"aliases"`
+			}
+			if err := json.Unmarshal(s.Vulnerability, &vulnerability); err != nil {
+				return nil, err
+			}
+			statement.ids = append([]string{vulnerability.Name}, vulnerability.Aliases...)
+		}
+		if statement.ids[0] == "" {
+			return nil, fmt.Errorf("statement without a vulnerability")
+		}
+
+		for _, p := range s.Products {
+			var id string
+			if err := json.Unmarshal(p, &id); err != nil {
+				var product struct {
+					ID string `json:"@id"`
+				}
+				if err := json.Unmarshal(p, &product); err != nil {
+					return nil, err
+				}
+				id = product.ID
+			}
+			statement.products = append(statement.products, id)
+		}
+
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// isNodejsProduct reports whether a product is the Node.js package, either
+// without a version or with the exact version, in the stream of
+// nodeMajorVersion. The epoch of RPM package URLs is in their qualifiers.
+func isNodejsProduct(product string, nodeMajorVersion uint64, version *rpmVersion) bool {
+	if !strings.HasPrefix(product, "pkg:") || !nodejsPackageNames[strings.ToLower(purlName(product))] {
+		return false
+	}
+
+	purl, qualifiers, _ := strings.Cut(product, "?")
+	_, productVersion, found := strings.Cut(purl, "@")
+	if !found {
+		return true
+	}
+	if version == nil {
+		return false
+	}
+
+	productVersion, err := url.PathUnescape(productVersion)
+	if err != nil {
+		return false
+	}
+	if values, err := url.ParseQuery(qualifiers); err == nil && values.Get("epoch") != "" && !strings.Contains(productVersion, ":") {
+		productVersion = values.Get("epoch") + ":" + productVersion
+	}
+
+	parsed, err := parseRPMVersion(productVersion)
+	return err == nil && parsed.major() == nodeMajorVersion && version.compare(parsed) == 0
+}
+
+// isImageProduct reports whether a product is the run image, given as an
+// image reference or a pkg:oci package URL.
+func isImageProduct(product string, runImage string) bool {
+	reference, err := ParseImageReference(runImage)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(product, "pkg:oci/") {
+		name, version, _ := strings.Cut(strings.SplitN(strings.TrimPrefix(product, "pkg:oci/"), "?", 2)[0], "@")
+		// Package URLs percent-encode the colon of the digest
+		version, err := url.PathUnescape(version)
+		if err != nil {
+			return false
+		}
+		return name == path.Base(reference.Name) && (version == "" || version == reference.Digest)
+	}
+
+	productReference, err := ParseImageReference(product)
+	if err != nil || productReference.Name != reference.Name {
+		return false
+	}
+	return productReference.Digest == "" || productReference.Digest == reference.Digest
+}
+
+// purlName returns the name of a package URL, without its namespace, version
+// and qualifiers.
+func purlName(purl string) string {
+	name := strings.SplitN(strings.SplitN(purl, "?", 2)[0], "@", 2)[0]
+	return path.Base(name)
+}
+
+func normalizeSeverity(severity string) string {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if alias, ok := severityAliases[severity]; ok {
+		return alias
+	}
+	if _, ok := severities[severity]; !ok {
+		return "unknown"
+	}
+	return severity
+}
@@ -0,0 +1,297 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+const osvFeed = `[
+  {
+    "id": "GHSA-unfixed",
+    "aliases": ["CVE-2024-0001"],
+    "affected": [{
+      "package": {"ecosystem": "Red Hat", "name": "nodejs"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1:22.1.0-1.el9"}]}],
+      "ecosystem_specific": {"severity": "Critical"}
+    }]
+  },
+  {
+    "id": "GHSA-fixed",
+    "aliases": ["CVE-2024-0002"],
+    "affected": [{
+      "package": {"purl": "pkg:generic/node"},
+      "ranges": [{"type": "SEMVER", "events": [
+        {"introduced": "18.0.0"}, {"fixed": "18.19.1"},
+        {"introduced": "20.0.0"}, {"fixed": "20.11.1"}
+      ]}]
+    }],
+    "database_specific": {"severity": "HIGH"}
+  },
+  {
+    "id": "GHSA-other-package",
+    "affected": [{
+      "package": {"name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}]}]
+    }],
+    "database_specific": {"severity": "CRITICAL"}
+  }
+]`
+
+const ovalFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<oval_definitions xmlns="http://oval.mitre.org/XMLSchema/oval-definitions-5">
+  <definitions>
+    <definition class="patch" id="oval:com.redhat.rhsa:def:20240505" version="1">
+      <metadata>
+        <title>RHSA-2024:0505: nodejs:20 security update (Moderate)</title>
+        <reference ref_id="RHSA-2024:0505" source="RHSA"/>
+        <reference ref_id="CVE-2024-0003" source="CVE"/>
+        <advisory from="secalert@redhat.com">
+          <severity>Moderate</severity>
+        </advisory>
+      </metadata>
+      <criteria operator="OR">
+        <criterion comment="Red Hat Enterprise Linux must be installed"/>
+        <criteria operator="AND">
+          <criterion comment="Module nodejs:20 is enabled"/>
+          <criterion comment="nodejs is earlier than 1:20.12.0-1.module+el8.9.0"/>
+          <criterion comment="nodejs is signed with Red Hat redhatrelease2 key"/>
+        </criteria>
+      </criteria>
+    </definition>
+  </definitions>
+</oval_definitions>`
+
+func testFindVulnerabilities(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		feeds  []utils.VulnerabilityFeed
+	)
+
+	it.Before(func() {
+		feeds = []utils.VulnerabilityFeed{
+			{Name: "osv.json", Content: []byte(osvFeed)},
+			{Name: "oval.xml", Content: []byte(ovalFeed)},
+		}
+	})
+
+	context("When the exact Node.js version is not known", func() {
+
+		it("should only report the vulnerabilities not fixed in the stream", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "Node.js 20"},
+			}))
+		})
+
+		it("should not report the vulnerabilities of other streams", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 22, "", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(BeEmpty())
+		})
+
+		it("should treat a major version as the stream", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "20", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "Node.js 20"},
+			}))
+		})
+	})
+
+	context("When the exact Node.js version is known", func() {
+
+		it("should report the vulnerabilities fixed in later versions", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "20.10.0", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "Node.js 20.10.0", Fixed: "1:22.1.0-1.el9"},
+				{ID: "GHSA-fixed", Severity: "high", Target: "Node.js 20.10.0", Fixed: "20.11.1"},
+				{ID: "RHSA-2024:0505", Severity: "medium", Target: "Node.js 20.10.0", Fixed: "1:20.12.0-1.module+el8.9.0"},
+			}))
+			Expect(vulnerabilities[1].String()).To(Equal("GHSA-fixed (high) in Node.js 20.10.0, fixed in 20.11.1"))
+		})
+
+		it("should not report the vulnerabilities fixed in the version", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "nodejs-1:20.12.0-1.module+el8.9.0.x86_64", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "nodejs-1:20.12.0-1.module+el8.9.0.x86_64", Fixed: "1:22.1.0-1.el9"},
+			}))
+		})
+
+		it("should compare a version without an epoch as epoch 0, as rpm does", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "20.18.0", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "Node.js 20.18.0", Fixed: "1:22.1.0-1.el9"},
+				{ID: "RHSA-2024:0505", Severity: "medium", Target: "Node.js 20.18.0", Fixed: "1:20.12.0-1.module+el8.9.0"},
+			}))
+		})
+
+		it("should compare the release of the package", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "nodejs-1:20.12.0-0.module+el8.8.0.x86_64", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "nodejs-1:20.12.0-0.module+el8.8.0.x86_64", Fixed: "1:22.1.0-1.el9"},
+				{ID: "RHSA-2024:0505", Severity: "medium", Target: "nodejs-1:20.12.0-0.module+el8.8.0.x86_64", Fixed: "1:20.12.0-1.module+el8.9.0"},
+			}))
+		})
+
+		it("should compare the versions the way rpm does", func() {
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "nodejs-1:20.12.0-1.module+el8.10.0.x86_64", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "nodejs-1:20.12.0-1.module+el8.10.0.x86_64", Fixed: "1:22.1.0-1.el9"},
+			}))
+		})
+	})
+
+	context("When OpenVEX statements are provided", func() {
+
+		it("should leave out the vulnerabilities Node.js is not affected by", func() {
+			feeds = append(feeds, utils.VulnerabilityFeed{Name: "vex.json", Content: []byte(`{
+				"@context": "https://openvex.dev/ns/v0.2.0",
+				"statements": [{
+					"vulnerability": {"name": "CVE-2024-0001"},
+					"products": [{"@id": "pkg:rpm/redhat/nodejs@20.12.0-1.module+el8.9.0?arch=x86_64&epoch=1"}],
+					"status": "not_affected",
+					"justification": "vulnerable_code_not_in_execute_path"
+				}]
+			}`)})
+
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "nodejs-1:20.12.0-1.module+el8.9.0.x86_64", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(BeEmpty())
+		})
+
+		it("should ignore the statements of other packages of the stream", func() {
+			feeds = append(feeds, utils.VulnerabilityFeed{Name: "vex.json", Content: []byte(`{
+				"statements": [{
+					"vulnerability": {"name": "CVE-2024-0001"},
+					"products": [{"@id": "pkg:rpm/redhat/nodejs@20.12.0-1.module+el8.9.0?arch=x86_64&epoch=1"}],
+					"status": "not_affected"
+				}]
+			}`)})
+
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(HaveLen(1))
+
+			vulnerabilities, err = utils.FindVulnerabilities(feeds, 20, "nodejs-1:20.12.0-2.module+el8.9.0.x86_64", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(HaveLen(1))
+		})
+
+		it("should ignore the statements of other streams", func() {
+			feeds = append(feeds, utils.VulnerabilityFeed{Name: "vex.json", Content: []byte(`{
+				"statements": [{"vulnerability": "CVE-2024-0001", "products": ["pkg:generic/node@18.19.1"], "status": "fixed"}]
+			}`)})
+
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(HaveLen(1))
+		})
+
+		it("should report the vulnerabilities of the run image with the severity of the advisories", func() {
+			feeds = append(feeds, utils.VulnerabilityFeed{Name: "vex.json", Content: []byte(`{
+				"statements": [
+					{"vulnerability": {"name": "CVE-2024-0003"}, "products": [{"@id": "pkg:oci/run-nodejs-20-ubi8-base"}], "status": "affected"},
+					{"vulnerability": {"name": "CVE-2024-0004"}, "products": [{"@id": "paketobuildpacks/run-nodejs-20-ubi8-base"}], "status": "affected"},
+					{"vulnerability": {"name": "CVE-2024-0005"}, "products": [{"@id": "paketobuildpacks/run-nodejs-18-ubi8-base"}], "status": "affected"},
+					{"vulnerability": {"name": "CVE-2024-0006"}, "products": [{"@id": "pkg:oci/run-nodejs-20-ubi8-base@sha256%3A` + strings.Repeat("a", 64) + `"}], "status": "affected"},
+					{"vulnerability": {"name": "CVE-2024-0007"}, "products": [{"@id": "pkg:oci/run-nodejs-20-ubi8-base@sha256%3A` + strings.Repeat("b", 64) + `"}], "status": "affected"}
+				]
+			}`)})
+
+			runImage := "paketobuildpacks/run-nodejs-20-ubi8-base@sha256:" + strings.Repeat("a", 64)
+			vulnerabilities, err := utils.FindVulnerabilities(feeds, 20, "", runImage)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vulnerabilities).To(Equal([]utils.Vulnerability{
+				{ID: "GHSA-unfixed", Severity: "critical", Target: "Node.js 20"},
+				{ID: "CVE-2024-0003", Severity: "medium", Target: runImage},
+				{ID: "CVE-2024-0004", Severity: "unknown", Target: runImage},
+				{ID: "CVE-2024-0006", Severity: "unknown", Target: runImage},
+			}))
+		})
+	})
+
+	context("Failure cases", func() {
+
+		it("should error for a document that is not a vulnerability feed", func() {
+			_, err := utils.FindVulnerabilities([]utils.VulnerabilityFeed{{Name: "feed.json", Content: []byte(`{"name": "feed"}`)}}, 20, "", "")
+			Expect(err).To(MatchError("failed to parse vulnerability feed feed.json: neither an OSV, OpenVEX nor OVAL document"))
+		})
+
+		it("should error for a malformed Node.js version", func() {
+			_, err := utils.FindVulnerabilities(feeds, 20, "twenty", "")
+			Expect(err).To(MatchError(ContainSubstring("failed to parse Node.js version 'twenty'")))
+		})
+	})
+}
+
+func testGetVulnerabilityFeeds(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		platformDir string
+	)
+
+	it.Before(func() {
+		platformDir = t.TempDir()
+
+		// The resolver prefers these over the platform directory, even when empty
+		for _, name := range []string{"SERVICE_BINDING_ROOT", "CNB_BINDINGS", "VCAP_SERVICES"} {
+			t.Setenv(name, "")
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	it("should return no feeds without a path and bindings", func() {
+		feeds, err := utils.GetVulnerabilityFeeds("", platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(feeds).To(BeEmpty())
+	})
+
+	it("should return the files of a directory and the entries of the bindings", func() {
+		feedsDir := t.TempDir()
+		Expect(os.WriteFile(filepath.Join(feedsDir, "osv.json"), []byte(osvFeed), 0644)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(feedsDir, "archive"), 0755)).To(Succeed())
+		Expect(testhelpers.WriteServiceBinding(filepath.Join(platformDir, "bindings"), "security", "vulnerability-feed", map[string][]byte{
+			"rhel-8.oval.xml": []byte(ovalFeed),
+		})).To(Succeed())
+
+		feeds, err := utils.GetVulnerabilityFeeds(feedsDir, platformDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(feeds).To(Equal([]utils.VulnerabilityFeed{
+			{Name: filepath.Join(feedsDir, "osv.json"), Content: []byte(osvFeed)},
+			{Name: "entry rhel-8.oval.xml of binding security", Content: []byte(ovalFeed)},
+		}))
+	})
+
+	it("should error for a path that does not exist", func() {
+		_, err := utils.GetVulnerabilityFeeds(filepath.Join(platformDir, "missing.json"), platformDir)
+		Expect(err).To(MatchError(ContainSubstring("failed to read vulnerability feed")))
+	})
+
+	it("should rank the severities", func() {
+		rank, err := utils.GetSeverityRank("Moderate")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rank).To(Equal(2))
+
+		rank, err = utils.GetSeverityRank("critical")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rank).To(Equal(4))
+
+		_, err = utils.GetSeverityRank("severe")
+		Expect(err).To(MatchError("unsupported severity 'severe', expected 'low', 'medium', 'high' or 'critical'"))
+	})
+}
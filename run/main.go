@@ -10,6 +10,7 @@ import (
 
 	ubinodejsextension "github.com/paketo-buildpacks/ubi-nodejs-extension"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 )
 
 const IMAGES_JSON_PATH = "/etc/buildpacks/images.json"
@@ -17,7 +18,9 @@ const IMAGES_JSON_PATH = "/etc/buildpacks/images.json"
 func main() {
 	dependencyManager := postal.NewService(cargo.NewTransport())
 	logEmitter := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
-	duringBuildPermissions := utils.GetDuringBuildPermissions("/etc/passwd")
+	duringBuildPermissions := func() (structs.DuringBuildPermissions, string, error) {
+		return utils.GetDuringBuildPermissions("/etc/passwd", "/etc/group", os.LookupEnv)
+	}
 
 	packit.RunExtension(
 		ubinodejsextension.Detect(),
@@ -42,6 +42,8 @@ function main() {
     util::print::info "Setting default target platform architecture to: linux/amd64"
   fi
 
+  targets::validate
+
   run::build
   cmd::build
 
@@ -61,10 +63,45 @@ OPTIONS
   --target strings  Target platforms to build for.
                     Targets should be in the format '[os][/arch][/variant]'.
                       - To specify two different architectures: '--target "linux/amd64" --target "linux/arm64"'
+                      - The supported targets are the [[targets]] of the extension.toml:
+                        linux/amd64, linux/arm64, linux/s390x and linux/ppc64le
   --help  -h        prints the command usage
 USAGE
 }
 
+# Lists the targets of the extension.toml, or of the buildpack.toml, as os/arch.
+function targets::supported() {
+  local toml
+  toml="${BUILDPACKDIR}/extension.toml"
+  if [[ ! -f "${toml}" ]]; then
+    toml="${BUILDPACKDIR}/buildpack.toml"
+  fi
+
+  awk '
+    /^\[\[targets\]\]/ { in_target = 1; os = ""; arch = ""; next }
+    /^\[/ { in_target = 0 }
+    in_target && $1 == "os" { gsub(/"/, "", $3); os = $3 }
+    in_target && $1 == "arch" { gsub(/"/, "", $3); arch = $3 }
+    in_target && os != "" && arch != "" { print os "/" arch; os = ""; arch = "" }
+  ' "${toml}"
+}
+
+function targets::validate() {
+  local supported
+  supported="$(targets::supported)"
+
+  # Without any targets in the toml file every target is allowed, as before.
+  if [[ -z "${supported}" ]]; then
+    return
+  fi
+
+  for target in "${targets[@]}"; do
+    if ! grep -qx "${target}" <<< "${supported}"; then
+      util::print::error "unsupported target \"${target}\", expected one of: $(echo ${supported})"
+    fi
+  done
+}
+
 function run::build() {
   if [[ -f "${BUILDPACKDIR}/run/main.go" ]]; then
     pushd "${BUILDPACKDIR}" > /dev/null || return
@@ -2,16 +2,182 @@ package structs
 
 type DuringBuildPermissions struct {
 	CNB_USER_ID, CNB_GROUP_ID int
+
+	// CNB_USER_HOME is the home directory of the CNB user in the passwd
+	// file, empty when the user is not in it.
+	CNB_USER_HOME string
+}
+
+// PackageManager describes how packages are installed in an image. Command
+// is what gets invoked, and Detect, when set, is a shell assignment that has
+// to run first to resolve it.
+type PackageManager struct {
+	Name           string
+	Command        string
+	Detect         string
+	InstallOptions string
+}
+
+// File is written into an image by the generated Dockerfiles, with its
+// Content base64 encoded so that it can be inlined safely.
+type File struct {
+	Name    string
+	Content string
+}
+
+// BindingFile is copied from the Source path of a service binding to Dest
+// while the generated Dockerfiles are applied, as the platform dir is
+// available to the extender, so that its content is never written into an
+// instruction.
+type BindingFile struct {
+	Source string
+	Dest   string
+}
+
+// EnvVar is set in the run image built from the generated Dockerfile.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// Label is added to the images built from the generated Dockerfiles.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// SBOM is written into an image at Path by running the base64 encoded
+// Script with Node.js once the packages are installed, with the base64
+// encoded Metadata of the Node.js dependency.
+type SBOM struct {
+	Path     string
+	Script   string
+	Metadata string
+}
+
+// Symlink points Link at Target once the packages are installed. Remove
+// deletes the Link a package installed first, which fails when it is
+// missing, and Force replaces it.
+type Symlink struct {
+	Link   string
+	Target string
+	Remove bool
+	Force  bool
 }
 
 type BuildDockerfileProps struct {
 	NODEJS_VERSION            uint64
 	CNB_USER_ID, CNB_GROUP_ID int
-	CNB_STACK_ID, PACKAGES    string
-	SET_SYMLINKS              string
+	PACKAGES                  []string
+	SYMLINKS                  []Symlink
 	ENABLE_NODEJS_MODULE      bool
+	PACKAGE_MANAGER           PackageManager
+	FIPS                      bool
+	CA_CERTIFICATES           []File
+
+	// BUILD_ARGS are the names of the build arguments passed through the
+	// extend config, declared so that they reach the RUN instructions.
+	BUILD_ARGS []string
+
+	// PACKAGE_CACHE keeps the repository metadata and the downloaded
+	// packages in the PACKAGE_CACHE_DIR, to be reused by the next build.
+	PACKAGE_CACHE bool
+
+	// INPUTS_HASH is set to the hash of the generated instructions when the
+	// Dockerfile is generated, which leaves out the LABELS.
+	INPUTS_HASH string
+	LABELS      []Label
+
+	// RHSM are the subscription files of the service binding that are only
+	// present while the packages are installed, with the RHSM_REPOSITORY
+	// that uses them. They are left out of the INPUTS_HASH, like the LABELS.
+	RHSM            []BindingFile
+	RHSM_REPOSITORY File
+
+	// REPOSITORIES and GPG_KEYS are added before the packages are installed,
+	// with the repositories of the image moved aside when
+	// DISABLE_DEFAULT_REPOSITORIES is set.
+	REPOSITORIES                 []File
+	GPG_KEYS                     []File
+	DISABLE_DEFAULT_REPOSITORIES bool
+
+	// SBOM lists the packages installed by the RUN instruction, when its
+	// Path is set.
+	SBOM SBOM
+
+	// GPGCHECK enforces the GPG signature check of the installed packages,
+	// which needs signing keys in the image.
+	GPGCHECK bool
+
+	// LOCALE_PACKAGES are the langpacks and time zone data installed with
+	// the PACKAGES, and LOCALE_ENV the LANG and TZ variables set for them. TIMEZONE_DATA reinstalls tzdata when the image ships it
+	// without the zoneinfo files, as ubi-minimal does.
+	LOCALE_PACKAGES []string
+	LOCALE_ENV      []EnvVar
+	TIMEZONE_DATA   bool
+
+	// FULL_ICU_PACKAGES provide the full ICU data of Node.js, which is
+	// checked once they are installed.
+	FULL_ICU_PACKAGES []string
+
+	// VERIFY checks once the packages are installed that node reports the
+	// NODEJS_VERSION major, and that npm runs when VERIFY_NPM is set, so that
+	// a broken module stream or symlink fails the build of the image.
+	VERIFY     bool
+	VERIFY_NPM bool
 }
 
 type RunDockerfileProps struct {
 	Source string
+	LABELS []Label
+
+	// FIPS and CA_CERTIFICATES also apply when the run image is switched, in
+	// which case the PACKAGE_MANAGER, repository and CNB user fields are
+	// needed as well.
+	FIPS            bool
+	CA_CERTIFICATES []File
+
+	// The fields below are only used when EXTEND is set, in which case the
+	// Node.js runtime is installed on top of the run image of the builder.
+	EXTEND                    bool
+	NODEJS_VERSION            uint64
+	CNB_USER_ID, CNB_GROUP_ID int
+	PACKAGES                  []string
+	SYMLINKS                  []Symlink
+	ENABLE_NODEJS_MODULE      bool
+	PACKAGE_MANAGER           PackageManager
+
+	// The repositories are removed again from the run image once the
+	// packages are installed.
+	REPOSITORIES                 []File
+	GPG_KEYS                     []File
+	DISABLE_DEFAULT_REPOSITORIES bool
+
+	// SBOM lists the packages installed into the run image when its Path is
+	// set.
+	SBOM SBOM
+
+	// GPGCHECK enforces the GPG signature check of the installed packages.
+	GPGCHECK bool
+
+	// OPENSHIFT prepares the run image for arbitrary user IDs in group 0,
+	// installing the NSS_WRAPPER_PACKAGE and the base64 encoded
+	// NSS_WRAPPER_SCRIPT, with CNB_USER_HOME as their home.
+	OPENSHIFT           bool
+	NSS_WRAPPER_PACKAGE string
+	NSS_WRAPPER_SCRIPT  string
+	CNB_USER_HOME       string
+
+	// LOCALE_PACKAGES are the langpacks and time zone data installed into the
+	// run image, as in BuildDockerfileProps.
+	LOCALE_PACKAGES []string
+	TIMEZONE_DATA   bool
+
+	// FULL_ICU_PACKAGES are installed and checked as in BuildDockerfileProps.
+	FULL_ICU_PACKAGES []string
+
+	// ENV and RUN_USER configure the processes of the run image, in every
+	// mode. RUN_USER is left out when empty.
+	ENV      []EnvVar
+	RUN_USER string
 }